@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+
+	uuid "github.com/satori/go.uuid"
+	appIdentity "github.com/thataway/common-lib/app/identity"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//AppIdentityUnary unary interceptor puts app_identity Name, Version and InstanceID into outgoing metadata;
+//headers are set by caller are kept as is
+func AppIdentityUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(withAppIdentity(ctx), method, req, reply, cc, opts...)
+}
+
+//AppIdentityStream is like AppIdentityUnary
+func AppIdentityStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(withAppIdentity(ctx), desc, cc, method, opts...)
+}
+
+//WithAppIdentity wraps HTTP transport to put app_identity Name, Version and InstanceID into request headers;
+//nil transport is http.DefaultTransport
+func WithAppIdentity(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if _, ok := transport.(appIdentityRoundTripper); ok {
+		return transport
+	}
+	return appIdentityRoundTripper{wrapped: transport}
+}
+
+type appIdentityRoundTripper struct {
+	wrapped http.RoundTripper
+}
+
+//RoundTrip impl http.RoundTripper
+func (rt appIdentityRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var cloned bool
+	for _, kv := range appIdentityHeaders() {
+		if len(req.Header.Values(kv[0])) > 0 {
+			continue
+		}
+		if !cloned { //RoundTripper should not modify request
+			req, cloned = req.Clone(req.Context()), true
+		}
+		req.Header.Set(kv[0], kv[1])
+	}
+	return rt.wrapped.RoundTrip(req)
+}
+
+func withAppIdentity(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var kv []string
+	for _, h := range appIdentityHeaders() {
+		if len(md.Get(h[0])) == 0 {
+			kv = append(kv, h[0], h[1])
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func appIdentityHeaders() [][2]string {
+	var ret [][2]string
+	if len(appIdentity.Name) > 0 {
+		ret = append(ret, [2]string{conventions.AppNameHeader, appIdentity.Name})
+	}
+	if len(appIdentity.Version) > 0 {
+		ret = append(ret, [2]string{conventions.AppVersionHeader, appIdentity.Version})
+	}
+	if appIdentity.InstanceID != uuid.Nil {
+		ret = append(ret, [2]string{conventions.AppInstanceHeader, appIdentity.InstanceID.String()})
+	}
+	return ret
+}
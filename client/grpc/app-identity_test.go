@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appIdentity "github.com/thataway/common-lib/app/identity"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAppIdentity(t *testing.T) {
+	appIdentity.Name, appIdentity.Version = "test-app", "1.0"
+	defer func() {
+		appIdentity.Name, appIdentity.Version = "", ""
+	}()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), conventions.AppNameHeader, "caller")
+	md, _ := metadata.FromOutgoingContext(withAppIdentity(ctx))
+	assert.Equal(t, []string{"caller"}, md.Get(conventions.AppNameHeader))
+	assert.Equal(t, []string{"1.0"}, md.Get(conventions.AppVersionHeader))
+	assert.Equal(t, []string{appIdentity.InstanceID.String()}, md.Get(conventions.AppInstanceHeader))
+	assert.Equal(t, "caller", conventions.ClientName.Outgoing(withAppIdentity(ctx), ""))
+
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: WithAppIdentity(nil)}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(conventions.AppVersionHeader, "2.0")
+	resp, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_ = resp.Body.Close()
+	assert.Equal(t, "test-app", headers.Get(conventions.AppNameHeader))
+	assert.Equal(t, "2.0", headers.Get(conventions.AppVersionHeader))
+	assert.Equal(t, appIdentity.InstanceID.String(), headers.Get(conventions.AppInstanceHeader))
+	assert.Empty(t, req.Header.Get(conventions.AppNameHeader))
+}
@@ -0,0 +1,246 @@
+package grpc
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/roundrobin"
+	_ "google.golang.org/grpc/health" //enables client side health checks
+	"google.golang.org/grpc/resolver"
+)
+
+//BalancingPolicy how endpoint is chosen for call
+type BalancingPolicy string
+
+const (
+	//BalanceRoundRobin endpoints are chosen in turn
+	BalanceRoundRobin BalancingPolicy = roundrobin.Name
+	//BalanceLeastRequest endpoint with less calls in flight of two random ones is chosen
+	BalanceLeastRequest BalancingPolicy = "sbr_least_request"
+	//BalanceWeighted endpoints are chosen in turn according to their weights
+	BalanceWeighted BalancingPolicy = "sbr_weighted"
+)
+
+//WeightedEndpoint endpoint with weight for BalanceWeighted policy; weight less than 1 is 1
+type WeightedEndpoint struct {
+	*pkgNet.Endpoint
+	Weight int
+}
+
+//Balancing calls are balanced between endpoints or between addresses are resolved from DNS name;
+//endpoints are unhealthy by standard GRPC health service are ejected until they are healthy again
+type Balancing struct {
+	//Policy how endpoint is chosen for call; BalanceRoundRobin if empty
+	Policy BalancingPolicy
+
+	//Endpoints tcp and unix endpoints calls are balanced between
+	Endpoints []WeightedEndpoint
+
+	//DNSName "host:port" addresses are resolved from when Endpoints are empty; their weights are equal
+	DNSName string
+
+	//HealthService name of service is checked by health service; "" means server as a whole
+	HealthService string
+
+	//NoHealthCheck endpoints are not checked by health service
+	NoHealthCheck bool
+}
+
+//BalanceEndpoints calls are balanced between endpoints with equal weights
+func BalanceEndpoints(policy BalancingPolicy, endpoints ...*pkgNet.Endpoint) Balancing {
+	ret := Balancing{Policy: policy}
+	for _, ep := range endpoints {
+		ret.Endpoints = append(ret.Endpoints, WeightedEndpoint{Endpoint: ep, Weight: 1})
+	}
+	return ret
+}
+
+//DialParams target and dial options to dial with grpc.Dial or grpc.DialContext
+func (b Balancing) DialParams() (target string, opts []grpc.DialOption, err error) {
+	const api = "Balancing.DialParams"
+	policy := b.Policy
+	if len(policy) == 0 {
+		policy = BalanceRoundRobin
+	}
+	if balancer.Get(string(policy)) == nil {
+		return "", nil, errors.Errorf("%s: unknown policy '%s'", api, policy)
+	}
+	conf := struct {
+		LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+		HealthCheckConfig   *struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"healthCheckConfig,omitempty"`
+	}{
+		LoadBalancingConfig: []map[string]struct{}{{string(policy): {}}},
+	}
+	if !b.NoHealthCheck {
+		conf.HealthCheckConfig = &struct {
+			ServiceName string `json:"serviceName"`
+		}{ServiceName: b.HealthService}
+	}
+	sc, err := json.Marshal(conf)
+	if err != nil {
+		return "", nil, errors.Wrap(err, api)
+	}
+	opts = append(opts, grpc.WithDefaultServiceConfig(string(sc)))
+	if len(b.Endpoints) == 0 {
+		if len(b.DNSName) == 0 {
+			return "", nil, errors.Errorf("%s: no endpoints and no DNS name", api)
+		}
+		return "dns:///" + b.DNSName, opts, nil
+	}
+	var rb endpointsResolverBuilder
+	fqns := make([]string, 0, len(b.Endpoints))
+	for _, ep := range b.Endpoints {
+		if ep.Endpoint == nil {
+			return "", nil, errors.Errorf("%s: nil endpoint", api)
+		}
+		addr := resolver.Address{
+			Addr:       ep.String(),
+			ServerName: ep.String(),
+			Attributes: attributes.New(weightAttrKey{}, ep.Weight),
+		}
+		if ep.IsUnixDomain() {
+			addr.Addr, addr.ServerName = ep.FQN(), "localhost"
+		}
+		rb.addrs = append(rb.addrs, addr)
+		fqns = append(fqns, ep.FQN())
+	}
+	opts = append(opts, grpc.WithResolvers(rb))
+	//target tells endpoints apart so conns to different ones do not share circuits and metrics
+	return endpointsScheme + ":///" + strings.Join(fqns, ","), opts, nil
+}
+
+type (
+	weightAttrKey struct{}
+
+	endpointsResolverBuilder struct {
+		addrs []resolver.Address
+	}
+
+	endpointsResolver struct{}
+
+	leastRequestPickerBuilder struct{}
+
+	leastRequestPicker struct {
+		conns []*inFlightConn
+	}
+
+	inFlightConn struct {
+		balancer.SubConn
+		inFlight int64
+	}
+
+	weightedPickerBuilder struct{}
+
+	weightedPicker struct {
+		mx    sync.Mutex
+		conns []*weightedConn
+		total int
+	}
+
+	weightedConn struct {
+		balancer.SubConn
+		weight  int
+		current int
+	}
+)
+
+const endpointsScheme = "sbr-endpoints"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(string(BalanceLeastRequest),
+		leastRequestPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(base.NewBalancerBuilder(string(BalanceWeighted),
+		weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+//Build impl resolver.Builder
+func (rb endpointsResolverBuilder) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	_ = cc.UpdateState(resolver.State{Addresses: rb.addrs}) //balancer reports its errors by itself
+	return endpointsResolver{}, nil
+}
+
+//Scheme impl resolver.Builder
+func (rb endpointsResolverBuilder) Scheme() string {
+	return endpointsScheme
+}
+
+//ResolveNow impl resolver.Resolver; endpoints are static
+func (endpointsResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+//Close impl resolver.Resolver
+func (endpointsResolver) Close() {}
+
+//Build impl base.PickerBuilder
+func (leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	ret := &leastRequestPicker{}
+	for sc := range info.ReadySCs {
+		ret.conns = append(ret.conns, &inFlightConn{SubConn: sc})
+	}
+	return ret
+}
+
+//Pick impl balancer.Picker; it is 'power of two choices'
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	c := p.conns[0]
+	if n := len(p.conns); n > 1 {
+		i := rand.Intn(n)                 //nolint:gosec
+		j := (i + 1 + rand.Intn(n-1)) % n //nolint:gosec
+		c = p.conns[i]
+		if atomic.LoadInt64(&p.conns[j].inFlight) < atomic.LoadInt64(&c.inFlight) {
+			c = p.conns[j]
+		}
+	}
+	atomic.AddInt64(&c.inFlight, 1)
+	return balancer.PickResult{
+		SubConn: c.SubConn,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(&c.inFlight, -1)
+		},
+	}, nil
+}
+
+//Build impl base.PickerBuilder
+func (weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	ret := &weightedPicker{}
+	for sc, sci := range info.ReadySCs {
+		w, _ := sci.Address.Attributes.Value(weightAttrKey{}).(int)
+		if w < 1 {
+			w = 1
+		}
+		ret.conns = append(ret.conns, &weightedConn{SubConn: sc, weight: w})
+		ret.total += w
+	}
+	return ret
+}
+
+//Pick impl balancer.Picker; it is smooth weighted round robin
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	var best *weightedConn
+	for _, c := range p.conns {
+		c.current += c.weight
+		if best == nil || c.current > best.current {
+			best = c
+		}
+	}
+	best.current -= p.total
+	return balancer.PickResult{SubConn: best.SubConn}, nil
+}
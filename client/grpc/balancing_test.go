@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type balancedBackend struct {
+	endpoint *pkgNet.Endpoint
+	health   *health.Server
+	calls    int32
+	holding  int32
+	release  chan struct{}
+}
+
+func TestBalancing(t *testing.T) {
+	backends := []*balancedBackend{
+		{endpoint: mustEndpoint(t, "tcp://127.0.0.1:7404")},
+		{endpoint: mustEndpoint(t, "tcp://127.0.0.1:7405")},
+		{endpoint: mustEndpoint(t, "unix://"+filepath.Join(t.TempDir(), "balanced.sock"))},
+	}
+	for _, b := range backends {
+		stop, err := b.serve()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer stop()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	check := func(conn grpc.ClientConnInterface, n int) {
+		client := healthpb.NewHealthClient(conn)
+		for i := 0; i < n; i++ {
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			assert.NoError(t, err)
+		}
+	}
+	//waitFor makes calls until every backend is ready and takes calls
+	waitFor := func(conn grpc.ClientConnInterface, bs ...*balancedBackend) {
+		for _, b := range bs {
+			atomic.StoreInt32(&b.calls, 0)
+		}
+		for ready := false; !ready && ctx.Err() == nil; {
+			check(conn, 1)
+			ready = true
+			for _, b := range bs {
+				ready = ready && atomic.LoadInt32(&b.calls) > 0
+			}
+		}
+		for _, b := range backends {
+			atomic.StoreInt32(&b.calls, 0)
+		}
+	}
+	calls := func(bs ...*balancedBackend) []int32 {
+		var ret []int32
+		for _, b := range bs {
+			ret = append(ret, atomic.LoadInt32(&b.calls))
+		}
+		return ret
+	}
+
+	//round robin between tcp and unix endpoints
+	conn, err := DialBuilder(nil).
+		WithoutRetry().
+		WithBalancing(BalanceEndpoints(BalanceRoundRobin,
+			backends[0].endpoint, backends[1].endpoint, backends[2].endpoint)).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.CloseConn() //nolint:errcheck
+	waitFor(conn, backends...)
+	check(conn, 30)
+	assert.Equal(t, []int32{10, 10, 10}, calls(backends...))
+
+	//unhealthy endpoint is ejected
+	backends[2].health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		atomic.StoreInt32(&backends[2].calls, 0)
+		if check(conn, 3); atomic.LoadInt32(&backends[2].calls) == 0 {
+			break
+		}
+	}
+	waitFor(conn, backends[0], backends[1])
+	check(conn, 20)
+	assert.Equal(t, []int32{10, 10, 0}, calls(backends...))
+	backends[2].health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	waitFor(conn, backends...)
+
+	//weighted with plain dial options
+	target, opts, err := Balancing{
+		Policy: BalanceWeighted,
+		Endpoints: []WeightedEndpoint{
+			{Endpoint: backends[0].endpoint, Weight: 1},
+			{Endpoint: backends[1].endpoint, Weight: 3},
+		},
+	}.DialParams()
+	if !assert.NoError(t, err) {
+		return
+	}
+	weighted, err := grpc.DialContext(ctx, target, append(opts, grpc.WithInsecure())...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer weighted.Close() //nolint:errcheck
+	waitFor(weighted, backends[0], backends[1])
+	check(weighted, 40)
+	assert.Equal(t, []int32{10, 30}, calls(backends[0], backends[1]))
+
+	//least request avoids endpoint is busy
+	leastRequest, err := DialBuilder(nil).
+		WithoutRetry().
+		WithBalancing(BalanceEndpoints(BalanceLeastRequest, backends[0].endpoint, backends[1].endpoint)).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer leastRequest.CloseConn() //nolint:errcheck
+	waitFor(leastRequest, backends[0], backends[1])
+	atomic.StoreInt32(&backends[1].holding, 1)
+	for i := 0; i < 20; i++ {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = healthpb.NewHealthClient(leastRequest).Check(ctx, &healthpb.HealthCheckRequest{})
+		}()
+		for held := false; !held; {
+			select {
+			case <-done:
+				held = true
+			case <-time.After(10 * time.Millisecond):
+				held = atomic.LoadInt32(&backends[1].calls) > 0
+			}
+		}
+	}
+	assert.Equal(t, []int32{19, 1}, calls(backends[0], backends[1]))
+
+	//DNS name
+	dns, err := DialBuilder(nil).
+		WithBalancing(Balancing{DNSName: "localhost:7404"}).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dns.CloseConn() //nolint:errcheck
+	check(dns, 1)
+
+	//conns to different endpoints have different targets
+	other, _, err := BalanceEndpoints(BalanceRoundRobin, backends[0].endpoint).DialParams()
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, target, other)
+	}
+
+	_, err = DialBuilder(nil).WithBalancing(Balancing{}).Dial(ctx)
+	assert.Error(t, err)
+	_, _, err = Balancing{Policy: "unknown", DNSName: "localhost:7404"}.DialParams()
+	assert.Error(t, err)
+}
+
+func (b *balancedBackend) serve() (func(), error) {
+	lis, err := pkgNet.Listen(b.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	b.health, b.release = health.NewServer(), make(chan struct{})
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if atomic.AddInt32(&b.calls, 1); atomic.LoadInt32(&b.holding) != 0 {
+				select {
+				case <-b.release:
+				case <-ctx.Done():
+				}
+			}
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, b.health)
+	go srv.Serve(lis) //nolint:errcheck
+	return func() {
+		close(b.release)
+		srv.Stop()
+	}, nil
+}
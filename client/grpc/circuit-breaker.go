@@ -0,0 +1,632 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	//CircuitOption ...
+	CircuitOption func(*circuitOptions)
+
+	//CircuitState state of circuit
+	CircuitState int
+
+	//CircuitScope what circuits are keyed by
+	CircuitScope int
+
+	//OnCircuitStateEvent it is sent when circuit changes its state
+	OnCircuitStateEvent struct {
+		observer.EventType
+		Key  string
+		From CircuitState
+		To   CircuitState
+		At   time.Time
+	}
+
+	//OnCircuitStateEventObserver ...
+	OnCircuitStateEventObserver func(OnCircuitStateEvent)
+)
+
+const (
+	//CircuitClosed calls go through
+	CircuitClosed CircuitState = iota
+	//CircuitOpen calls are rejected
+	CircuitOpen
+	//CircuitHalfOpen some probe calls go through to decide to close or to open circuit again
+	CircuitHalfOpen
+)
+
+const (
+	//CircuitPerTarget one circuit per target (connection target or host of HTTP request)
+	CircuitPerTarget CircuitScope = iota
+	//CircuitPerMethod one circuit per method of target (GRPC method or HTTP route - see CircuitHTTPRoute)
+	CircuitPerMethod
+)
+
+const (
+	//DefaultCircuitFailures consecutive failures trip circuit if no trip mode is set
+	DefaultCircuitFailures = 5
+	//DefaultCircuitOpenTimeout how long circuit is open before half-open probing
+	DefaultCircuitOpenTimeout = 10 * time.Second
+	//DefaultCircuitIdleTimeout circuits are not used for this time are forgotten
+	DefaultCircuitIdleTimeout = 10 * time.Minute
+)
+
+//ErrCircuitOpen call is rejected by open circuit; GRPC calls get it as Unavailable status
+var ErrCircuitOpen = errors.New("circuit is open")
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+//CircuitTripOnFailures circuit trips when 'n' consecutive calls fail
+func CircuitTripOnFailures(n int) CircuitOption {
+	return func(o *circuitOptions) {
+		o.failures = n
+	}
+}
+
+//CircuitTripOnErrorRate circuit trips when rate of failed calls during 'window' reaches 'rate' (0..1);
+//it is checked when 'minCalls' calls are done during window at least
+func CircuitTripOnErrorRate(rate float64, minCalls int, window time.Duration) CircuitOption {
+	return func(o *circuitOptions) {
+		o.errorRate, o.minCalls, o.window = rate, minCalls, window
+	}
+}
+
+//CircuitOpenTimeout how long circuit is open before half-open probing; DefaultCircuitOpenTimeout by default
+func CircuitOpenTimeout(d time.Duration) CircuitOption {
+	return func(o *circuitOptions) {
+		o.openTimeout = d
+	}
+}
+
+//CircuitHalfOpenProbes how many probe calls go through half-open circuit at once;
+//circuit is closed when all of them succeed and is open again when one of them fails; 1 by default
+func CircuitHalfOpenProbes(n int) CircuitOption {
+	return func(o *circuitOptions) {
+		o.probes = n
+	}
+}
+
+//CircuitScopeBy sets what circuits are keyed by; CircuitPerTarget is default
+func CircuitScopeBy(s CircuitScope) CircuitOption {
+	return func(o *circuitOptions) {
+		o.scope = s
+	}
+}
+
+//CircuitHTTPRoute gives route of HTTP request (e.g. "GET /users/{id}") is method part of circuit key
+//for CircuitPerMethod scope; route is HTTP method by default because raw paths make circuits countless
+func CircuitHTTPRoute(f func(*http.Request) string) CircuitOption {
+	return func(o *circuitOptions) {
+		o.httpRoute = f
+	}
+}
+
+//CircuitIdleTimeout circuits are not used for this time are forgotten unless they are open;
+//DefaultCircuitIdleTimeout by default, zero or negative means never
+func CircuitIdleTimeout(d time.Duration) CircuitOption {
+	return func(o *circuitOptions) {
+		o.idleTimeout = d
+	}
+}
+
+//CircuitFailureCodes codes are failures of calls; Unavailable, DeadlineExceeded, ResourceExhausted
+//and Internal by default; HTTP responses 429 and 5xx and transport errors are mapped to these codes
+func CircuitFailureCodes(c ...codes.Code) CircuitOption {
+	return func(o *circuitOptions) {
+		o.failureCodes = append([]codes.Code(nil), c...)
+	}
+}
+
+//CircuitWithObservers добавим OnCircuitStateEvent обозревателей
+func CircuitWithObservers(obs ...OnCircuitStateEventObserver) CircuitOption {
+	return func(o *circuitOptions) {
+		o.observers = append(o.observers, obs...)
+	}
+}
+
+//CircuitBreaker rejects calls to degraded targets with ErrCircuitOpen; use it as client interceptors,
+//WithCircuitBreaker connection wrapper or WithCircuitBreakerTransport HTTP transport;
+//calls canceled by caller are not counted; streams are judged by establishing only
+type CircuitBreaker struct {
+	opts    circuitOptions
+	subject observer.Subject
+
+	mx       sync.Mutex
+	circuits map[string]*circuit
+	sweptAt  time.Time
+}
+
+//NewCircuitBreaker makes circuit breaker
+func NewCircuitBreaker(opts ...CircuitOption) *CircuitBreaker {
+	ret := &CircuitBreaker{
+		opts: circuitOptions{
+			openTimeout: DefaultCircuitOpenTimeout,
+			idleTimeout: DefaultCircuitIdleTimeout,
+			probes:      1,
+			failureCodes: []codes.Code{
+				codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal,
+			},
+		},
+		circuits: make(map[string]*circuit),
+	}
+	for _, o := range opts {
+		o(&ret.opts)
+	}
+	if ret.opts.failures <= 0 && ret.opts.errorRate <= 0 {
+		ret.opts.failures = DefaultCircuitFailures
+	}
+	if ret.opts.probes < 1 {
+		ret.opts.probes = 1
+	}
+	if len(ret.opts.observers) > 0 {
+		ret.subject = observer.NewSubject()
+		var evt OnCircuitStateEvent
+		seen := make(map[reflect.Value]bool)
+		for _, obs := range ret.opts.observers {
+			if v := reflect.ValueOf(obs); !seen[v] {
+				seen[v] = true
+			} else {
+				continue
+			}
+			obs := obs
+			o := observer.NewObserver(func(event observer.EventType) {
+				if ev, ok := event.(OnCircuitStateEvent); ok {
+					obs(ev)
+				}
+			}, false, evt)
+			ret.subject.ObserversAttach(o)
+		}
+		ret.opts.observers = nil
+		runtime.SetFinalizer(ret, func(o *CircuitBreaker) {
+			o.subject.DetachAllObservers()
+		})
+	}
+	return ret
+}
+
+//CircuitKey key of circuit of CircuitPerMethod scope; it is target for CircuitPerTarget scope
+func CircuitKey(target, method string) string {
+	return target + " " + method
+}
+
+//State current state of circuit by key; key is target for CircuitPerTarget scope and CircuitKey otherwise
+func (cb *CircuitBreaker) State(key string) CircuitState {
+	cb.mx.Lock()
+	c := cb.circuits[key]
+	cb.mx.Unlock()
+	if c == nil {
+		return CircuitClosed
+	}
+	ret, events := c.currentState(time.Now())
+	cb.notify(events)
+	return ret
+}
+
+//Unary unary client interceptor
+func (cb *CircuitBreaker) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return cb.call(ctx, targetOf(cc), method, func() error {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+//Stream stream client interceptor
+func (cb *CircuitBreaker) Stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	var ret grpc.ClientStream
+	err := cb.call(ctx, targetOf(cc), method, func() error {
+		var e error
+		ret, e = streamer(ctx, desc, cc, method, opts...)
+		return e
+	})
+	return ret, err
+}
+
+//WithCircuitBreaker wraps connection to pass calls through circuit breaker;
+//target of connection is given by its Target() method if it has one
+func WithCircuitBreaker(c grpc.ClientConnInterface, cb *CircuitBreaker) grpc.ClientConnInterface {
+	if _, ok := c.(circuitBreakerInterface); ok || cb == nil {
+		return c
+	}
+	base := &circuitBreakerConn{
+		breaker: cb,
+		wrapped: c,
+	}
+	if t, _ := c.(interface{ Target() string }); t != nil {
+		base.target = t.Target()
+	}
+	if closable, _ := c.(Closable); closable != nil {
+		type resType = struct {
+			circuitBreakerInterface
+			Closable
+		}
+		return resType{
+			circuitBreakerInterface: base,
+			Closable:                closable,
+		}
+	}
+	if closer, _ := c.(io.Closer); closer != nil {
+		type resType = struct {
+			circuitBreakerInterface
+			io.Closer
+		}
+		return resType{
+			circuitBreakerInterface: base,
+			Closer:                  closer,
+		}
+	}
+	return base
+}
+
+//WithCircuitBreakerTransport wraps HTTP transport to pass requests through circuit breaker;
+//target is host of request and method is route given by CircuitHTTPRoute; nil transport is http.DefaultTransport
+func WithCircuitBreakerTransport(transport http.RoundTripper, cb *CircuitBreaker) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if _, ok := transport.(circuitBreakerRoundTripper); ok || cb == nil {
+		return transport
+	}
+	return circuitBreakerRoundTripper{breaker: cb, wrapped: transport}
+}
+
+type (
+	circuitOptions struct {
+		failures     int
+		errorRate    float64
+		minCalls     int
+		window       time.Duration
+		openTimeout  time.Duration
+		idleTimeout  time.Duration
+		probes       int
+		scope        CircuitScope
+		httpRoute    func(*http.Request) string
+		failureCodes []codes.Code
+		observers    []OnCircuitStateEventObserver
+	}
+
+	circuit struct {
+		opts *circuitOptions
+		key  string
+
+		mx         sync.Mutex
+		state      CircuitState
+		generation uint64
+		failures   int
+		buckets    []circuitBucket
+		openedAt   time.Time
+		usedAt     time.Time
+		probes     int
+		probesSucc int
+	}
+
+	circuitBucket struct {
+		epoch  int64
+		calls  int
+		failed int
+	}
+
+	//circuitTicket is given to call is let through circuit
+	circuitTicket struct {
+		generation uint64
+		probe      bool
+	}
+
+	circuitOpenError struct {
+		key string
+	}
+
+	circuitBreakerInterface interface {
+		grpc.ClientConnInterface
+		isCircuitBreaker()
+	}
+
+	circuitBreakerConn struct {
+		breaker *CircuitBreaker
+		target  string
+		wrapped grpc.ClientConnInterface
+	}
+
+	circuitBreakerRoundTripper struct {
+		breaker *CircuitBreaker
+		wrapped http.RoundTripper
+	}
+)
+
+const circuitWindowBuckets = 10
+
+var _ circuitBreakerInterface = (*circuitBreakerConn)(nil)
+
+//Invoke impl grpc.ClientConnInterface
+func (c *circuitBreakerConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return c.breaker.call(ctx, c.target, method, func() error {
+		return c.wrapped.Invoke(ctx, method, args, reply, opts...)
+	})
+}
+
+//NewStream impl grpc.ClientConnInterface
+func (c *circuitBreakerConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	var ret grpc.ClientStream
+	err := c.breaker.call(ctx, c.target, method, func() error {
+		var e error
+		ret, e = c.wrapped.NewStream(ctx, desc, method, opts...)
+		return e
+	})
+	return ret, err
+}
+
+func (c *circuitBreakerConn) isCircuitBreaker() {}
+
+//RoundTrip impl http.RoundTripper
+func (rt circuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	route := req.Method
+	if f := rt.breaker.opts.httpRoute; f != nil {
+		route = f(req)
+	}
+	c := rt.breaker.circuitOf(req.URL.Host, route)
+	ticket, ok, events := c.allow(time.Now())
+	rt.breaker.notify(events)
+	if !ok {
+		if req.Body != nil {
+			_ = req.Body.Close() //RoundTripper must close body even on errors
+		}
+		return nil, errors.WithStack(circuitOpenError{key: c.key})
+	}
+	resp, err := rt.wrapped.RoundTrip(req)
+	var code codes.Code
+	switch {
+	case err != nil && ctx.Err() != nil:
+		code = status.FromContextError(ctx.Err()).Code()
+	case err != nil:
+		code = codes.Unavailable
+	case resp.StatusCode == http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case resp.StatusCode >= http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	rt.breaker.report(c, ticket, code)
+	return resp, err
+}
+
+//Error impl error
+func (e circuitOpenError) Error() string {
+	return ErrCircuitOpen.Error() + " for '" + e.key + "'"
+}
+
+//GRPCStatus gives Unavailable status
+func (e circuitOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+//Is makes errors.Is(err, ErrCircuitOpen) true
+func (e circuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen //nolint:errorlint
+}
+
+func targetOf(cc *grpc.ClientConn) string {
+	if cc == nil {
+		return ""
+	}
+	return cc.Target()
+}
+
+func (cb *CircuitBreaker) call(ctx context.Context, target, method string, f func() error) error {
+	c := cb.circuitOf(target, method)
+	ticket, ok, events := c.allow(time.Now())
+	cb.notify(events)
+	if !ok {
+		return circuitOpenError{key: c.key}
+	}
+	err := f()
+	code := status.Code(err)
+	if err != nil && ctx.Err() != nil {
+		code = status.FromContextError(ctx.Err()).Code()
+	}
+	cb.report(c, ticket, code)
+	return err
+}
+
+func (cb *CircuitBreaker) report(c *circuit, ticket circuitTicket, code codes.Code) {
+	var events []OnCircuitStateEvent
+	if code == codes.Canceled {
+		events = c.release(ticket)
+	} else {
+		events = c.done(ticket, cb.isFailure(code), time.Now())
+	}
+	cb.notify(events)
+}
+
+func (cb *CircuitBreaker) isFailure(code codes.Code) bool {
+	for _, c := range cb.opts.failureCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (cb *CircuitBreaker) circuitOf(target, method string) *circuit {
+	key := target
+	if cb.opts.scope == CircuitPerMethod {
+		key = CircuitKey(target, method)
+	}
+	now := time.Now()
+	cb.mx.Lock()
+	defer cb.mx.Unlock()
+	if idle := cb.opts.idleTimeout; idle > 0 && now.Sub(cb.sweptAt) >= idle {
+		cb.sweptAt = now
+		for k, c := range cb.circuits {
+			if c.isIdle(now) {
+				delete(cb.circuits, k)
+			}
+		}
+	}
+	ret := cb.circuits[key]
+	if ret == nil {
+		ret = &circuit{opts: &cb.opts, key: key}
+		cb.circuits[key] = ret
+	}
+	return ret
+}
+
+func (cb *CircuitBreaker) notify(events []OnCircuitStateEvent) {
+	if subj := cb.subject; subj != nil {
+		for _, ev := range events {
+			subj.Notify(ev)
+		}
+	}
+}
+
+func (c *circuit) currentState(now time.Time) (CircuitState, []OnCircuitStateEvent) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	events := c.expireOpen(now)
+	return c.state, events
+}
+
+//expireOpen open circuit becomes half-open after open timeout
+func (c *circuit) expireOpen(now time.Time) []OnCircuitStateEvent {
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= c.opts.openTimeout {
+		return []OnCircuitStateEvent{c.switchTo(CircuitHalfOpen, now)}
+	}
+	return nil
+}
+
+//isIdle circuit is not used for idle timeout and it does not reject calls
+func (c *circuit) isIdle(now time.Time) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return now.Sub(c.usedAt) >= c.opts.idleTimeout &&
+		(c.state != CircuitOpen || now.Sub(c.openedAt) >= c.opts.openTimeout)
+}
+
+func (c *circuit) allow(now time.Time) (circuitTicket, bool, []OnCircuitStateEvent) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.usedAt = now
+	events := c.expireOpen(now)
+	ticket := circuitTicket{generation: c.generation}
+	switch c.state {
+	case CircuitOpen:
+		return ticket, false, events
+	case CircuitHalfOpen:
+		if c.probes >= c.opts.probes {
+			return ticket, false, events
+		}
+		c.probes++
+		ticket.probe = true
+	}
+	return ticket, true, events
+}
+
+func (c *circuit) release(ticket circuitTicket) []OnCircuitStateEvent {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if ticket.probe && ticket.generation == c.generation {
+		c.probes--
+	}
+	return nil
+}
+
+func (c *circuit) done(ticket circuitTicket, failed bool, now time.Time) []OnCircuitStateEvent {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if ticket.generation != c.generation {
+		return nil
+	}
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			return []OnCircuitStateEvent{c.switchTo(CircuitOpen, now)}
+		}
+		if c.probesSucc++; c.probesSucc >= c.opts.probes {
+			return []OnCircuitStateEvent{c.switchTo(CircuitClosed, now)}
+		}
+	case CircuitClosed:
+		if c.trips(failed, now) {
+			return []OnCircuitStateEvent{c.switchTo(CircuitOpen, now)}
+		}
+	}
+	return nil
+}
+
+//trips counts result of call in closed circuit and says if circuit should be open
+func (c *circuit) trips(failed bool, now time.Time) bool {
+	var ret bool
+	if c.opts.failures > 0 {
+		if failed {
+			c.failures++
+		} else {
+			c.failures = 0
+		}
+		ret = c.failures >= c.opts.failures
+	}
+	if c.opts.errorRate > 0 && c.opts.window > 0 {
+		if c.buckets == nil {
+			c.buckets = make([]circuitBucket, circuitWindowBuckets)
+		}
+		width := int64(c.opts.window / circuitWindowBuckets)
+		if width <= 0 {
+			width = 1
+		}
+		epoch := now.UnixNano() / width
+		b := &c.buckets[epoch%circuitWindowBuckets]
+		if b.epoch != epoch {
+			*b = circuitBucket{epoch: epoch}
+		}
+		b.calls++
+		if failed {
+			b.failed++
+		}
+		var calls, fails int
+		for _, b := range c.buckets {
+			if epoch-b.epoch < circuitWindowBuckets {
+				calls, fails = calls+b.calls, fails+b.failed
+			}
+		}
+		ret = ret || (calls > 0 && calls >= c.opts.minCalls && float64(fails)/float64(calls) >= c.opts.errorRate)
+	}
+	return ret
+}
+
+func (c *circuit) switchTo(state CircuitState, now time.Time) OnCircuitStateEvent {
+	ev := OnCircuitStateEvent{Key: c.key, From: c.state, To: state, At: now}
+	c.state = state
+	c.generation++
+	c.failures, c.probes, c.probesSucc = 0, 0, 0
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	if state == CircuitClosed {
+		c.buckets = nil
+	}
+	return ev
+}
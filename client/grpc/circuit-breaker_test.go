@@ -0,0 +1,229 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/client/grpc/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const addr = "127.0.0.1:7403"
+	var (
+		calls   int32
+		failing int32
+	)
+	lis, err := net.Listen("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.LoadInt32(&failing) != 0 {
+				return nil, status.Error(codes.Unavailable, "unavailable")
+			}
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	var (
+		mx     sync.Mutex
+		events []OnCircuitStateEvent
+	)
+	cb := NewCircuitBreaker(
+		CircuitTripOnFailures(2),
+		CircuitOpenTimeout(100*time.Millisecond),
+		CircuitScopeBy(CircuitPerMethod),
+		CircuitWithObservers(func(ev OnCircuitStateEvent) {
+			mx.Lock()
+			events = append(events, ev)
+			mx.Unlock()
+		}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := DialBuilder(mustEndpoint(t, "tcp://"+addr)).
+		WithoutRetry().
+		WithCircuitBreaker(cb).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.CloseConn() //nolint:errcheck
+	client := healthpb.NewHealthClient(conn)
+	check := func() error {
+		_, e := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return errors.Cause(e)
+	}
+
+	//consecutive failures trip circuit
+	atomic.StoreInt32(&failing, 1)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, codes.Unavailable, status.Code(check()))
+	}
+	atomic.StoreInt32(&calls, 0)
+	err = check()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+	key := CircuitKey(addr, "/grpc.health.v1.Health/Check")
+	assert.Equal(t, CircuitOpen, cb.State(key))
+
+	//failed probe opens circuit again
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, codes.Unavailable, status.Code(check()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.ErrorIs(t, check(), ErrCircuitOpen)
+
+	//successful probe closes circuit
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, check())
+	assert.Equal(t, CircuitClosed, cb.State(key))
+	assert.NoError(t, check())
+
+	mx.Lock()
+	var transitions []CircuitState
+	for _, ev := range events {
+		assert.Equal(t, key, ev.Key)
+		transitions = append(transitions, ev.To)
+	}
+	mx.Unlock()
+	assert.Equal(t, []CircuitState{
+		CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed,
+	}, transitions)
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var code int32 = http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&code)))
+	}))
+	defer srv.Close()
+
+	cb := NewCircuitBreaker(
+		CircuitTripOnErrorRate(0.5, 4, time.Minute),
+		CircuitOpenTimeout(time.Minute),
+	)
+	client := http.Client{Transport: WithCircuitBreakerTransport(nil, cb)}
+	get := func() error {
+		resp, e := client.Get(srv.URL + "/some")
+		if e == nil {
+			_ = resp.Body.Close()
+		}
+		return e
+	}
+	for _, c := range []int32{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK} {
+		atomic.StoreInt32(&code, c)
+		assert.NoError(t, get())
+	}
+	atomic.StoreInt32(&code, http.StatusTooManyRequests)
+	assert.NoError(t, get()) //error rate is 0.5 of 4 calls
+	assert.ErrorIs(t, get(), ErrCircuitOpen)
+	assert.Equal(t, CircuitOpen, cb.State(srv.Listener.Addr().String()))
+
+	//body of rejected request is closed
+	body := &closeTracker{Reader: strings.NewReader("body")}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/some", body)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Transport.RoundTrip(req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.True(t, body.closed)
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestCircuitBreakerIdleCircuits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+	get := func(client http.Client, path string) {
+		resp, e := client.Get(srv.URL + path)
+		if assert.NoError(t, e) {
+			_ = resp.Body.Close()
+		}
+	}
+	keys := func(cb *CircuitBreaker) []string {
+		cb.mx.Lock()
+		defer cb.mx.Unlock()
+		var ret []string
+		for k := range cb.circuits {
+			ret = append(ret, k)
+		}
+		return ret
+	}
+
+	//raw paths do not make circuits
+	cb := NewCircuitBreaker(CircuitScopeBy(CircuitPerMethod))
+	client := http.Client{Transport: WithCircuitBreakerTransport(nil, cb)}
+	get(client, "/users/1")
+	get(client, "/users/2")
+	assert.Equal(t, []string{CircuitKey(host, http.MethodGet)}, keys(cb))
+
+	//routes make circuits; idle ones are forgotten
+	cb = NewCircuitBreaker(
+		CircuitScopeBy(CircuitPerMethod),
+		CircuitIdleTimeout(100*time.Millisecond),
+		CircuitHTTPRoute(func(req *http.Request) string {
+			return req.Method + " " + path.Dir(req.URL.Path) + "/{id}"
+		}),
+	)
+	client = http.Client{Transport: WithCircuitBreakerTransport(nil, cb)}
+	get(client, "/users/1")
+	get(client, "/users/2")
+	get(client, "/groups/1")
+	assert.ElementsMatch(t, []string{
+		CircuitKey(host, "GET /users/{id}"), CircuitKey(host, "GET /groups/{id}"),
+	}, keys(cb))
+	time.Sleep(150 * time.Millisecond)
+	get(client, "/groups/2")
+	assert.Equal(t, []string{CircuitKey(host, "GET /groups/{id}")}, keys(cb))
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	cb := NewCircuitBreaker()
+	c := WithCircuitBreaker(MakeCloseable(new(internal.InvalidConn)), cb)
+	_, ok := c.(circuitBreakerInterface)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, c, WithCircuitBreaker(c, cb))
+	if !assert.NoError(t, c.(Closable).CloseConn()) {
+		return
+	}
+	for i := 0; i < DefaultCircuitFailures; i++ {
+		assert.ErrorIs(t, c.Invoke(context.Background(), "/service1/method1", nil, nil), ErrConnClosed)
+	}
+	assert.Equal(t, CircuitClosed, cb.State("")) //closed conn error is not a failure of target
+}
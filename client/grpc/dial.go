@@ -0,0 +1,221 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/pkg/errors"
+	appIdentity "github.com/thataway/common-lib/app/identity"
+	clientMetrics "github.com/thataway/common-lib/client/metrics/prometheus"
+	clientTrace "github.com/thataway/common-lib/client/trace/ot"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+//DefaultMetrics client metrics are used by DialBuilder; register it in prometheus registry to export them
+var DefaultMetrics = clientMetrics.NewMetrics()
+
+//DefaultKeepalive keepalive parameters used by DialBuilder; pings are not often than servers allow by default
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:    5 * time.Minute,
+	Timeout: 20 * time.Second,
+}
+
+//DialBuilder makes builder of client connection to endpoint "tcp://host:port" or "unix:///path";
+//endpoint may be nil if connection is balanced by WithBalancing;
+//by default connection has keepalive, tracing by global tracer provider, DefaultMetrics,
+//user agent and identity headers from app_identity and errors wrapped like WithErrorWrapper does;
+//calls are not retried by default - methods are safe to retry are given by WithRetry;
+//attempts and retried calls are counted by DefaultMetrics as 'method_attempts' and 'methods_retried'
+func DialBuilder(endpoint *pkgNet.Endpoint) dialBuilder { //nolint:revive
+	return dialBuilder{
+		inner: &dialBuilderState{
+			endpoint:  endpoint,
+			keepalive: &DefaultKeepalive,
+			metrics:   DefaultMetrics,
+			userAgent: defaultUserAgent(),
+		},
+	}
+}
+
+type (
+	dialBuilder struct {
+		inner *dialBuilderState
+	}
+
+	dialBuilderState struct {
+		endpoint          *pkgNet.Endpoint
+		balancing         *Balancing
+		keepalive         *keepalive.ClientParameters
+		retry             []RetryOption
+		circuitBreaker    *CircuitBreaker
+		tracerProvider    trace.TracerProvider
+		metrics           *clientMetrics.ClientMetrics
+		userAgent         string
+		serviceNamePrefix string
+		tlsConfig         *tls.Config
+		block             bool
+		grpcOptions       []grpc.DialOption
+	}
+)
+
+//WithBalancing calls are balanced between endpoints of balancing instead of endpoint of builder
+func (b dialBuilder) WithBalancing(balancing Balancing) dialBuilder {
+	b.inner.balancing = &balancing
+	return b
+}
+
+//WithKeepalive sets keepalive parameters; nil disables keepalive pings
+func (b dialBuilder) WithKeepalive(p *keepalive.ClientParameters) dialBuilder {
+	b.inner.keepalive = p
+	return b
+}
+
+//WithRetry sets retry policies of methods; look at Retrier
+func (b dialBuilder) WithRetry(opts ...RetryOption) dialBuilder {
+	b.inner.retry = append(b.inner.retry, opts...)
+	return b
+}
+
+//WithoutRetry calls are not retried; it is default
+func (b dialBuilder) WithoutRetry() dialBuilder {
+	b.inner.retry = nil
+	return b
+}
+
+//WithCircuitBreaker calls go through circuit breaker before retries; nil disables it; it is disabled by default
+func (b dialBuilder) WithCircuitBreaker(cb *CircuitBreaker) dialBuilder {
+	b.inner.circuitBreaker = cb
+	return b
+}
+
+//WithTracerProvider calls are traced by tracer provider instead of global one; nil disables tracing
+func (b dialBuilder) WithTracerProvider(tp trace.TracerProvider) dialBuilder {
+	b.inner.tracerProvider = tp
+	if tp == nil {
+		b.inner.tracerProvider = trace.NewNoopTracerProvider()
+	}
+	return b
+}
+
+//WithMetrics calls are counted by metrics instead of DefaultMetrics; nil disables metrics
+func (b dialBuilder) WithMetrics(m *clientMetrics.ClientMetrics) dialBuilder {
+	b.inner.metrics = m
+	return b
+}
+
+//WithUserAgent sets user agent instead of one from app_identity
+func (b dialBuilder) WithUserAgent(ua string) dialBuilder {
+	b.inner.userAgent = ua
+	return b
+}
+
+//WithServiceNamePrefix prefix of service name in wrapped errors; look at WithErrorWrapper
+func (b dialBuilder) WithServiceNamePrefix(prefix string) dialBuilder {
+	b.inner.serviceNamePrefix = prefix
+	return b
+}
+
+//WithTLS connection is secured by TLS; it is insecure by default
+func (b dialBuilder) WithTLS(conf *tls.Config) dialBuilder {
+	b.inner.tlsConfig = conf
+	return b
+}
+
+//WithBlock Dial waits until connection is up
+func (b dialBuilder) WithBlock() dialBuilder {
+	b.inner.block = true
+	return b
+}
+
+//WithDialOptions adds GRPC dial options; they are applied last
+func (b dialBuilder) WithDialOptions(opts ...grpc.DialOption) dialBuilder {
+	b.inner.grpcOptions = append(b.inner.grpcOptions, opts...)
+	return b
+}
+
+//Dial makes client connection
+func (b dialBuilder) Dial(ctx context.Context) (ClosableClientConnInterface, error) {
+	const api = "DialBuilder.Dial"
+	st := b.inner
+	opts := st.dialOptions()
+	var target, dest string
+	switch {
+	case st.balancing != nil:
+		balancingTarget, balancingOpts, err := st.balancing.DialParams()
+		if err != nil {
+			return nil, errors.Wrap(err, api)
+		}
+		target, dest = balancingTarget, balancingTarget
+		opts = append(balancingOpts, opts...)
+	case st.endpoint != nil:
+		target, dest = st.endpoint.String(), st.endpoint.FQN()
+		if st.endpoint.IsUnixDomain() {
+			target = dest
+		}
+	default:
+		return nil, errors.Errorf("%s: no endpoint", api)
+	}
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: to '%s'", api, dest)
+	}
+	ret := WithErrorWrapper(MakeCloseable(conn), st.serviceNamePrefix)
+	return ret.(ClosableClientConnInterface), nil
+}
+
+func (st *dialBuilderState) dialOptions() []grpc.DialOption {
+	var (
+		ret    []grpc.DialOption
+		unary  []grpc.UnaryClientInterceptor
+		stream []grpc.StreamClientInterceptor
+	)
+	if st.tlsConfig != nil {
+		ret = append(ret, grpc.WithTransportCredentials(credentials.NewTLS(st.tlsConfig)))
+	} else {
+		ret = append(ret, grpc.WithInsecure())
+	}
+	if st.keepalive != nil {
+		ret = append(ret, grpc.WithKeepaliveParams(*st.keepalive))
+	}
+	if len(st.userAgent) > 0 {
+		ret = append(ret, grpc.WithUserAgent(st.userAgent))
+	}
+	if st.block {
+		ret = append(ret, grpc.WithBlock())
+	}
+	if m := st.metrics; m != nil {
+		ret = append(ret, grpc.WithStatsHandler(m.StatsHandler()))
+		unary, stream = append(unary, m.UnaryInterceptor), append(stream, m.StreamInterceptor)
+	}
+	tp := st.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := clientTrace.NewClientGRPCTracer(tp)
+	unary, stream = append(unary, tracer.TraceUnaryCalls, AppIdentityUnary), append(stream, tracer.TraceStreamCalls, AppIdentityStream)
+	if cb := st.circuitBreaker; cb != nil {
+		unary, stream = append(unary, cb.Unary), append(stream, cb.Stream)
+	}
+	if len(st.retry) > 0 {
+		r := NewRetrier(st.retry...)
+		unary, stream = append(unary, r.Unary), append(stream, r.Stream)
+	}
+	ret = append(ret, grpc.WithChainUnaryInterceptor(unary...), grpc.WithChainStreamInterceptor(stream...))
+	return append(ret, st.grpcOptions...)
+}
+
+func defaultUserAgent() string {
+	if len(appIdentity.Name) == 0 {
+		return ""
+	}
+	if len(appIdentity.Version) == 0 {
+		return appIdentity.Name
+	}
+	return appIdentity.Name + "/" + appIdentity.Version
+}
@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	appIdentity "github.com/thataway/common-lib/app/identity"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestDialBuilder(t *testing.T) {
+	appIdentity.Name, appIdentity.Version = "test-app", "1.0"
+	defer func() {
+		appIdentity.Name, appIdentity.Version = "", ""
+	}()
+	sock := filepath.Join(os.TempDir(), fmt.Sprintf("dial-builder-%v.sock", time.Now().UnixNano()))
+	for _, addr := range []string{"tcp://127.0.0.1:7401", "unix://" + sock} {
+		t.Run(addr, func(t *testing.T) {
+			testDialBuilder(t, addr)
+		})
+	}
+}
+
+func testDialBuilder(t *testing.T, addr string) {
+	ep, err := pkgNet.ParseEndpoint(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	lis, err := pkgNet.Listen(ep)
+	if !assert.NoError(t, err) {
+		return
+	}
+	incoming := make(chan metadata.MD, 10)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			incoming <- md
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := DialBuilder(ep).
+		WithServiceNamePrefix("test").
+		WithBlock().
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.CloseConn() //nolint:errcheck
+	client := healthpb.NewHealthClient(conn)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	md := <-incoming
+	assert.Equal(t, []string{"test-app"}, md.Get(conventions.AppNameHeader))
+	assert.Equal(t, []string{"1.0"}, md.Get(conventions.AppVersionHeader))
+	assert.Equal(t, []string{appIdentity.InstanceID.String()}, md.Get(conventions.AppInstanceHeader))
+	if ua := md.Get(conventions.UserAgentHeader); assert.Len(t, ua, 1) {
+		assert.Regexp(t, `^test-app/1\.0 grpc-go/`, ua[0])
+	}
+	assert.Equal(t, "test-app", conventions.ClientName.Incoming(metadata.NewIncomingContext(ctx, md), ""))
+
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(errors.Cause(err)))
+	assert.Contains(t, err.Error(), "test/Health/Check")
+
+	assert.NoError(t, conn.CloseConn())
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.ErrorIs(t, err, ErrConnClosed)
+}
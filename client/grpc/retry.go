@@ -0,0 +1,363 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	otPriv "github.com/thataway/common-lib/internal/pkg/ot"
+	"github.com/thataway/common-lib/pkg/backoff"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+//RetryPolicy how calls of method are retried
+type RetryPolicy struct {
+	//Codes retryable codes; Unavailable if empty
+	Codes []codes.Code
+
+	//MaxAttempts max attempts of call including first one
+	MaxAttempts int
+
+	//Backoff makes backoff strategy for every call; exponential one from 100ms if nil
+	Backoff func() backoff.Backoff
+
+	//PerAttemptTimeout limits every attempt of unary call; attempt is out of it is retried as DeadlineExceeded one;
+	//zero means attempts are limited by deadline of call only
+	PerAttemptTimeout time.Duration
+
+	//HedgingDelay if positive next attempt of unary call starts when previous ones have no answer after delay
+	//and first successful answer wins; Codes are non fatal codes then; use it for idempotent methods only
+	HedgingDelay time.Duration
+}
+
+//DefaultRetryMax max attempts of call in DefaultRetryPolicy
+const DefaultRetryMax = 3
+
+//DefaultRetryPolicy retries Unavailable calls; give it to methods are safe to retry by RetryForMethod or RetryForService
+var DefaultRetryPolicy = RetryPolicy{
+	Codes:       []codes.Code{codes.Unavailable},
+	MaxAttempts: DefaultRetryMax,
+}
+
+//RetryOption ...
+type RetryOption func(*retryOptions)
+
+//RetryDefault policy of every method has no own one; methods are not retried if it is not set
+//so set it only if every method is safe to retry
+func RetryDefault(p RetryPolicy) RetryOption {
+	return func(o *retryOptions) {
+		o.def = p
+	}
+}
+
+//RetryForService policy of all methods of service
+func RetryForService(serviceFQN string, p RetryPolicy) RetryOption {
+	return func(o *retryOptions) {
+		o.services[serviceFQN] = p
+	}
+}
+
+//RetryForMethod policy of method of service
+func RetryForMethod(serviceFQN, method string, p RetryPolicy) RetryOption {
+	return func(o *retryOptions) {
+		o.methods[serviceFQN+"/"+method] = p
+	}
+}
+
+//Retrier client interceptors retry calls by policies of methods; delay before next attempt is given
+//by server pushback conventions.RetryPushbackHeader or by backoff; negative or invalid pushback stops retries;
+//attempts are noted as span events of call and are counted by client metrics
+//if their interceptors precede it in chain; streams are retried until they are established only;
+//methods have no policy are not retried
+type Retrier struct {
+	opts retryOptions
+}
+
+//NewRetrier makes retrier
+func NewRetrier(opts ...RetryOption) *Retrier {
+	ret := &Retrier{
+		opts: retryOptions{
+			services: make(map[string]RetryPolicy),
+			methods:  make(map[string]RetryPolicy),
+		},
+	}
+	for _, o := range opts {
+		o(&ret.opts)
+	}
+	return ret
+}
+
+//Unary unary client interceptor
+func (r *Retrier) Unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	p := r.opts.policyOf(method)
+	if p.MaxAttempts < 2 && p.PerAttemptTimeout <= 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if m, ok := reply.(proto.Message); ok && p.HedgingDelay > 0 && p.MaxAttempts > 1 {
+		//concurrent attempts get own header, trailer and peer; caller gets ones of winner
+		callOpts, outs := splitAttemptOutputs(opts)
+		return p.hedge(ctx, m, outs, func(actx context.Context, rep interface{}, out *attemptOutput) error {
+			return invoker(actx, method, req, rep, cc, append(callOpts[:len(callOpts):len(callOpts)],
+				grpc.Header(&out.header), grpc.Trailer(&out.trailer), grpc.Peer(&out.peer))...)
+		})
+	}
+	return p.retry(ctx, p.PerAttemptTimeout, func(actx context.Context, trailer *metadata.MD) error {
+		return invoker(actx, method, req, reply, cc, append(opts, grpc.Trailer(trailer))...)
+	})
+}
+
+//Stream stream client interceptor
+func (r *Retrier) Stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	p := r.opts.policyOf(method)
+	if p.MaxAttempts < 2 {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	var ret grpc.ClientStream
+	err := p.retry(ctx, 0, func(actx context.Context, _ *metadata.MD) error {
+		var e error
+		ret, e = streamer(actx, desc, cc, method, opts...)
+		return e
+	})
+	return ret, err
+}
+
+type attemptOutput struct {
+	header  metadata.MD
+	trailer metadata.MD
+	peer    peer.Peer
+}
+
+//splitAttemptOutputs separates header, trailer and peer options from other call options
+func splitAttemptOutputs(opts []grpc.CallOption) (rest, outs []grpc.CallOption) {
+	for _, o := range opts {
+		switch o.(type) {
+		case grpc.HeaderCallOption, grpc.TrailerCallOption, grpc.PeerCallOption:
+			outs = append(outs, o)
+		default:
+			rest = append(rest, o)
+		}
+	}
+	return rest, outs
+}
+
+//copyTo gives attempt header, trailer and peer to caller options
+func (out *attemptOutput) copyTo(outs []grpc.CallOption) {
+	for _, o := range outs {
+		switch v := o.(type) {
+		case grpc.HeaderCallOption:
+			*v.HeaderAddr = out.header
+		case grpc.TrailerCallOption:
+			*v.TrailerAddr = out.trailer
+		case grpc.PeerCallOption:
+			*v.PeerAddr = out.peer
+		}
+	}
+}
+
+type retryOptions struct {
+	def      RetryPolicy
+	services map[string]RetryPolicy
+	methods  map[string]RetryPolicy
+}
+
+func (o retryOptions) policyOf(method string) RetryPolicy {
+	var mi conventions.GrpcMethodInfo
+	if mi.Init(method) != nil {
+		return o.def
+	}
+	if p, ok := o.methods[mi.ServiceFQN+"/"+mi.Method]; ok {
+		return p
+	}
+	if p, ok := o.services[mi.ServiceFQN]; ok {
+		return p
+	}
+	return o.def
+}
+
+func (p RetryPolicy) retryable(code codes.Code) bool {
+	if len(p.Codes) == 0 {
+		return code == codes.Unavailable
+	}
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) newBackoff() backoff.Backoff {
+	var ret backoff.Backoff
+	if p.Backoff != nil {
+		ret = p.Backoff()
+	}
+	if ret == nil {
+		ret = backoff.ExponentialBackoffBuilder().
+			WithInitialInterval(100 * time.Millisecond).
+			WithMaxInterval(5 * time.Second).
+			WithMaxElapsedThreshold(0).
+			Build()
+	}
+	ret.Reset()
+	return ret
+}
+
+func (p RetryPolicy) retry(ctx context.Context, attemptTimeout time.Duration, call func(context.Context, *metadata.MD) error) error {
+	bo := p.newBackoff()
+	for attempt := 1; ; attempt++ {
+		var trailer metadata.MD
+		actx, cancel := withAttemptTimeout(ctx, attemptTimeout)
+		err := call(actx, &trailer)
+		code := attemptCode(ctx, actx, err)
+		cancel()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(code) || ctx.Err() != nil {
+			return err
+		}
+		delay, has, stop := retryPushback(trailer)
+		if stop {
+			return err
+		}
+		if !has {
+			if delay = bo.NextBackOff(); delay == backoff.Stop {
+				return err
+			}
+		}
+		addAttemptEvent(ctx, "retry", attempt+1, code, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p RetryPolicy) hedge(ctx context.Context, reply proto.Message, outs []grpc.CallOption,
+	call func(context.Context, interface{}, *attemptOutput) error) error {
+	type result struct {
+		reply proto.Message
+		err   error
+		code  codes.Code
+		out   *attemptOutput
+	}
+	hctx, cancelAll := context.WithCancel(ctx)
+	defer cancelAll()
+	results := make(chan result, p.MaxAttempts)
+	var started, pending int
+	start := func(code codes.Code) {
+		started++
+		pending++
+		if started > 1 {
+			addAttemptEvent(ctx, "hedge", started, code, 0)
+		}
+		rep := reply.ProtoReflect().New().Interface()
+		go func() {
+			out := new(attemptOutput)
+			actx, cancel := withAttemptTimeout(hctx, p.PerAttemptTimeout)
+			defer cancel()
+			err := call(actx, rep, out)
+			results <- result{reply: rep, err: err, code: attemptCode(hctx, actx, err), out: out}
+		}()
+	}
+	hedgeTimer := time.NewTimer(p.HedgingDelay)
+	defer hedgeTimer.Stop()
+	start(codes.OK)
+	var lastErr error
+	for pending > 0 || started < p.MaxAttempts {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-hedgeTimer.C:
+			if started < p.MaxAttempts {
+				start(codes.OK)
+				hedgeTimer.Reset(p.HedgingDelay)
+			}
+		case res := <-results:
+			pending--
+			res.out.copyTo(outs)
+			if res.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+			lastErr = res.err
+			if !p.retryable(res.code) {
+				return res.err
+			}
+			delay, has, stop := retryPushback(res.out.trailer)
+			switch {
+			case stop:
+				started = p.MaxAttempts
+			case has:
+				if !hedgeTimer.Stop() {
+					select {
+					case <-hedgeTimer.C:
+					default:
+					}
+				}
+				hedgeTimer.Reset(delay)
+			case started < p.MaxAttempts:
+				start(res.code)
+			}
+		}
+	}
+	return lastErr
+}
+
+func withAttemptTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+//attemptCode attempt is out of own timeout while call is in time is DeadlineExceeded
+func attemptCode(ctx, attemptCtx context.Context, err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return codes.DeadlineExceeded
+	}
+	return status.Code(err)
+}
+
+//retryPushback gives delay from server pushback; stop is true when server says not to retry
+func retryPushback(trailer metadata.MD) (delay time.Duration, has bool, stop bool) {
+	v := trailer.Get(conventions.RetryPushbackHeader)
+	if len(v) == 0 {
+		return 0, false, false
+	}
+	ms, err := strconv.ParseInt(v[0], 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false, true
+	}
+	return time.Duration(ms) * time.Millisecond, true, false
+}
+
+func addAttemptEvent(ctx context.Context, name string, attempt int, code codes.Code, delay time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		otPriv.RPCAttemptKey.Int(attempt),
+		semconv.RPCGRPCStatusCodeKey.Int(int(code)),
+	}
+	if delay > 0 {
+		attrs = append(attrs, otPriv.RPCRetryDelayKey.Int64(delay.Milliseconds()))
+	}
+	span.AddEvent(name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,181 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetrier(t *testing.T) {
+	const addr = "127.0.0.1:7402"
+	var (
+		calls    int32
+		behavior atomic.Value
+	)
+	type behaviorFunc = func(ctx context.Context, n int32) error
+	behavior.Store(behaviorFunc(func(context.Context, int32) error { return nil }))
+	lis, err := net.Listen("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if e := behavior.Load().(behaviorFunc)(ctx, atomic.AddInt32(&calls, 1)); e != nil {
+				return nil, e
+			}
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(sr))
+	noBackoff := func() RetryPolicy {
+		return RetryPolicy{
+			Codes:       []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+			MaxAttempts: 3,
+		}
+	}
+	policy := noBackoff()
+	policy.PerAttemptTimeout = 100 * time.Millisecond
+	hedging := noBackoff()
+	hedging.HedgingDelay = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := DialBuilder(nil).Dial(ctx)
+	assert.Error(t, err)
+	conn, err = DialBuilder(mustEndpoint(t, "tcp://"+addr)).
+		WithTracerProvider(tp).
+		WithRetry(RetryDefault(policy)).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.CloseConn() //nolint:errcheck
+	client := healthpb.NewHealthClient(conn)
+	check := func(b behaviorFunc) (int32, error) {
+		behavior.Store(b)
+		atomic.StoreInt32(&calls, 0)
+		_, e := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return atomic.LoadInt32(&calls), e
+	}
+
+	//Unavailable is retried until success
+	n, err := check(func(_ context.Context, n int32) error {
+		if n < 3 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), n)
+	if spans := sr.Ended(); assert.NotEmpty(t, spans) {
+		events := spans[len(spans)-1].Events()
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, "retry", events[0].Name)
+		}
+	}
+
+	//not retryable code
+	n, err = check(func(context.Context, int32) error {
+		return status.Error(codes.NotFound, "not found")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), n)
+
+	//max attempts
+	n, err = check(func(context.Context, int32) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), n)
+
+	//server pushback stops retries
+	n, err = check(func(ctx context.Context, _ int32) error {
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(conventions.RetryPushbackHeader, "-1"))
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), n)
+
+	//attempt out of per attempt timeout is retried
+	n, err = check(func(ctx context.Context, n int32) error {
+		if n == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), n)
+
+	//calls are not retried by default
+	plain, err := DialBuilder(mustEndpoint(t, "tcp://"+addr)).Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer plain.CloseConn() //nolint:errcheck
+	behavior.Store(behaviorFunc(func(context.Context, int32) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	}))
+	atomic.StoreInt32(&calls, 0)
+	_, err = healthpb.NewHealthClient(plain).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	//hedged call is answered by second attempt; caller gets its header
+	behavior.Store(behaviorFunc(func(ctx context.Context, n int32) error {
+		_ = grpc.SendHeader(ctx, metadata.Pairs("attempt", strconv.Itoa(int(n))))
+		if n == 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return nil
+	}))
+	hedged, err := DialBuilder(mustEndpoint(t, "tcp://"+addr)).
+		WithRetry(
+			RetryForService("grpc.health.v1.Health", hedging),
+			RetryForMethod("grpc.health.v1.Health", "Watch", RetryPolicy{MaxAttempts: 1}),
+		).
+		Dial(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer hedged.CloseConn() //nolint:errcheck
+	atomic.StoreInt32(&calls, 0)
+	timePoint := time.Now()
+	var header metadata.MD
+	resp, err := healthpb.NewHealthClient(hedged).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, header.Get("attempt"))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	assert.Less(t, int64(time.Since(timePoint)), int64(time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func mustEndpoint(t *testing.T, addr string) *pkgNet.Endpoint {
+	ep, err := pkgNet.ParseEndpoint(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ep
+}
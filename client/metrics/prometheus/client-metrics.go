@@ -0,0 +1,216 @@
+package prometheus_metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+type (
+	//Option опции метрик
+	Option interface {
+		apply(*clientMetricsOptions)
+	}
+
+	clientMetricsOptions struct {
+		Namespace           string
+		Subsystem           string
+		ResponseTimeBuckets []float64
+		ConstLabels         prometheus.Labels
+	}
+
+	//ClientMetrics клиентские метрики GRPC; их источник - stats.Handler и interceptors, которые ставятся DialOptions
+	ClientMetrics struct {
+		started      *prometheus.CounterVec
+		finished     *prometheus.CounterVec
+		messages     *prometheus.CounterVec
+		retries      *prometheus.CounterVec
+		attempts     *prometheus.HistogramVec
+		responseTime *prometheus.HistogramVec
+		connections  *prometheus.GaugeVec
+		connState    *prometheus.GaugeVec
+		connStateMx  sync.Mutex
+		trackedConns sync.Map
+	}
+
+	clientMetricsOptionApplier func(*clientMetricsOptions)
+)
+
+const ( //possible metrics labels
+	LabelTarget     string = "target"         //nolint
+	LabelRemoteAddr        = "remote_address" //nolint
+	LabelService           = "service"        //nolint
+	LabelMethod            = "method"         //nolint
+	LabelState             = "state"          //nolint
+	LabelGRPCCode          = "grpc_code"      //nolint
+)
+
+const ( //label values
+	Received      string = "received" //nolint
+	Sent                 = "sent"     //nolint
+	UnknownTarget        = "unknown"  //nolint
+)
+
+const (
+	DefaultNamespace = "sbr"         //nolint
+	DefaultSubsystem = "grpc_client" //nolint
+)
+
+var (
+	_ prometheus.Collector = (*ClientMetrics)(nil)
+	_ Option               = (clientMetricsOptionApplier)(nil)
+)
+
+//NewMetrics ...
+func NewMetrics(opts ...Option) *ClientMetrics {
+	options := clientMetricsOptions{
+		Namespace: DefaultNamespace,
+		Subsystem: DefaultSubsystem,
+		ResponseTimeBuckets: []float64{
+			.0001, .0005, .00075, .001, .0025, .005, 0.0075, .01, 0.025, .05, 0.075,
+			.1, .25, .5, .75, 1, 2.5, 5, 7.5, 10, 25, 50, 75, 100, 500, 1000},
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	methodLabels := []string{LabelTarget, LabelService, LabelMethod}
+	return &ClientMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_started",
+			Help:        "started methods counter",
+		}, methodLabels),
+		finished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_finished",
+			Help:        "finished methods counter",
+		}, append(methodLabels, LabelGRPCCode)),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "messages",
+			Help:        "received and sent message counters",
+		}, append(methodLabels, LabelState)),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_retried",
+			Help:        "counter of repeated attempts of methods",
+		}, methodLabels),
+		attempts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "method_attempts",
+			Help:        "attempts per call of methods",
+			Buckets:     []float64{1, 2, 3, 4, 5, 7, 10},
+		}, methodLabels),
+		responseTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "response_time",
+			Help:        "response time duration in milliseconds",
+			Buckets:     options.ResponseTimeBuckets,
+		}, methodLabels),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "connections",
+			Help:        "connection count at moment on a client",
+		}, []string{LabelRemoteAddr}),
+		connState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "conn_state",
+			Help:        "count of client connections are in state",
+		}, []string{LabelTarget, LabelState}),
+	}
+}
+
+//StatsHandler stats handler for grpc.WithStatsHandler; it does not know target of conn so
+//target label is 'unknown' unless UnaryInterceptor and StreamInterceptor are used too - see DialOptions
+func (m *ClientMetrics) StatsHandler() stats.Handler {
+	return (*clientStatsHandler)(m)
+}
+
+//DialOptions stats handler and interceptors with all metrics
+func (m *ClientMetrics) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithStatsHandler(m.StatsHandler()),
+		grpc.WithChainUnaryInterceptor(m.UnaryInterceptor),
+		grpc.WithChainStreamInterceptor(m.StreamInterceptor),
+	}
+}
+
+func (m *ClientMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.started, m.finished, m.messages, m.retries, m.attempts, m.responseTime, m.connections, m.connState,
+	}
+}
+
+//Describe impl prometheus.Collector
+func (m *ClientMetrics) Describe(c chan<- *prometheus.Desc) {
+	for _, coll := range m.collectors() {
+		coll.Describe(c)
+	}
+}
+
+//Collect impl prometheus.Collector
+func (m *ClientMetrics) Collect(c chan<- prometheus.Metric) {
+	m.updateConnStates()
+	for _, coll := range m.collectors() {
+		coll.Collect(c)
+	}
+}
+
+//WithNamespace sets Namespace to metrics
+func WithNamespace(ns string) Option {
+	var ret clientMetricsOptionApplier = func(options *clientMetricsOptions) {
+		options.Namespace = ns
+	}
+	return ret
+}
+
+//WithSubsystem  sets Subsystem to metrics
+func WithSubsystem(ss string) Option {
+	var ret clientMetricsOptionApplier = func(options *clientMetricsOptions) {
+		options.Subsystem = ss
+	}
+	return ret
+}
+
+//WithResponseTimeBuckets sets buckets in milliseconds of response time histogram
+func WithResponseTimeBuckets(buckets ...float64) Option {
+	var ret clientMetricsOptionApplier = func(options *clientMetricsOptions) {
+		options.ResponseTimeBuckets = append([]float64(nil), buckets...)
+	}
+	return ret
+}
+
+//WithConstLabels adds constant labels to all metrics
+func WithConstLabels(labels prometheus.Labels) Option {
+	var ret clientMetricsOptionApplier = func(options *clientMetricsOptions) {
+		if options.ConstLabels == nil {
+			options.ConstLabels = make(prometheus.Labels)
+		}
+		for k, v := range labels {
+			options.ConstLabels[k] = v
+		}
+	}
+	return ret
+}
+
+func (f clientMetricsOptionApplier) apply(o *clientMetricsOptions) {
+	f(o)
+}
@@ -0,0 +1,103 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	grpcRetry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientMetrics(t *testing.T) {
+	const addr = "127.0.0.1:7400"
+	lis, err := net.Listen("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis) //nolint:errcheck
+	defer srv.Stop()
+
+	cm := NewMetrics(WithSubsystem("test"), WithResponseTimeBuckets(1000))
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(cm); !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dialOpts := append(cm.DialOptions(),
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithChainUnaryInterceptor(grpcRetry.UnaryClientInterceptor(
+			grpcRetry.WithCodes(codes.NotFound),
+			grpcRetry.WithMax(3),
+		)),
+	)
+	cc, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cc.Close() //nolint
+	client := healthpb.NewHealthClient(cc)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	if !assert.Equal(t, codes.NotFound, status.Code(err)) {
+		return
+	}
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(recorder, r)
+		return recorder.Body.String()
+	}
+	payload := scrape()
+	labs := `method="Check",service="grpc.health.v1.Health",target="` + addr + `"`
+	rePat := []string{
+		`(?m)^sbr_test_methods_started\{` + labs + `\} 4$`,
+		`(?m)^sbr_test_methods_finished\{grpc_code="OK",` + labs + `\} 1$`,
+		`(?m)^sbr_test_methods_finished\{grpc_code="NotFound",` + labs + `\} 3$`,
+		`(?m)^sbr_test_methods_retried\{` + labs + `\} 2$`,
+		`(?m)^sbr_test_messages\{method="Check",service="grpc.health.v1.Health",state="sent",target="` + addr + `"\} 4$`,
+		`(?m)^sbr_test_response_time_bucket\{` + labs + `,le="1000"\} 4$`,
+		`(?m)^sbr_test_connections\{remote_address="tcp://` + addr + `"\} 1$`,
+		`(?m)^sbr_test_conn_state\{state="READY",target="` + addr + `"\} 1$`,
+		`(?m)^sbr_test_conn_state\{state="IDLE",target="` + addr + `"\} 0$`,
+	}
+	for _, pattern := range rePat {
+		assert.Regexpf(t, regexp.MustCompile(pattern), payload, "on-metric-pattern:'%s'", pattern)
+	}
+
+	//conns of the same target are counted together and closed ones are gone
+	cc2, err := grpc.DialContext(ctx, addr, dialOpts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cm.TrackConn(cc2)
+	assert.Regexp(t, `(?m)^sbr_test_conn_state\{state="READY",target="`+addr+`"\} 2$`, scrape())
+	_ = cc.Close()
+	_ = cc2.Close()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if payload = scrape(); !strings.Contains(payload, "sbr_test_conn_state") {
+			break
+		}
+	}
+	assert.NotContains(t, payload, "sbr_test_conn_state")
+}
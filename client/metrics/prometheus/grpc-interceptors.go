@@ -0,0 +1,120 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+type (
+	callStateCtxKey struct{}
+
+	//callState of call goes through interceptor; attempts are counted by stats handler
+	callState struct {
+		target   string
+		attempts int32
+	}
+)
+
+//UnaryInterceptor gives target label to metrics and counts attempts and retries done by interceptors are next in chain;
+//it tracks state of connection too
+func (m *ClientMetrics) UnaryInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, call := m.beginCall(ctx, cc)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	m.endCall(method, call)
+	return err
+}
+
+//StreamInterceptor is like UnaryInterceptor
+func (m *ClientMetrics) StreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, call := m.beginCall(ctx, cc)
+	ret, err := streamer(ctx, desc, cc, method, opts...)
+	m.endCall(method, call)
+	return ret, err
+}
+
+//TrackConn connection state is counted in conn_state gauge until connection is closed
+func (m *ClientMetrics) TrackConn(cc *grpc.ClientConn) {
+	if cc == nil {
+		return
+	}
+	if _, loaded := m.trackedConns.LoadOrStore(cc, struct{}{}); !loaded {
+		go func() {
+			for st := cc.GetState(); st != connectivity.Shutdown; st = cc.GetState() {
+				cc.WaitForStateChange(context.Background(), st)
+			}
+			m.trackedConns.Delete(cc)
+		}()
+	}
+}
+
+func (m *ClientMetrics) beginCall(ctx context.Context, cc *grpc.ClientConn) (context.Context, *callState) {
+	call := &callState{target: UnknownTarget}
+	if cc != nil {
+		call.target = cc.Target()
+		m.TrackConn(cc)
+	}
+	return context.WithValue(ctx, callStateCtxKey{}, call), call
+}
+
+func (m *ClientMetrics) endCall(method string, call *callState) {
+	n := atomic.LoadInt32(&call.attempts)
+	if n == 0 {
+		return
+	}
+	var mi conventions.GrpcMethodInfo
+	if mi.Init(method) != nil {
+		return
+	}
+	labs := prometheus.Labels{
+		LabelTarget:  call.target,
+		LabelService: mi.ServiceFQN,
+		LabelMethod:  mi.Method,
+	}
+	m.attempts.With(labs).Observe(float64(n))
+	if n > 1 {
+		m.retries.With(labs).Add(float64(n - 1))
+	}
+}
+
+func (m *ClientMetrics) updateConnStates() {
+	states := []connectivity.State{
+		connectivity.Idle, connectivity.Connecting, connectivity.Ready,
+		connectivity.TransientFailure, connectivity.Shutdown,
+	}
+	counts := make(map[string]map[connectivity.State]int)
+	m.trackedConns.Range(func(k, _ interface{}) bool {
+		cc := k.(*grpc.ClientConn)
+		byState := counts[cc.Target()]
+		if byState == nil {
+			byState = make(map[connectivity.State]int)
+			counts[cc.Target()] = byState
+		}
+		byState[cc.GetState()]++
+		return true
+	})
+	m.connStateMx.Lock()
+	defer m.connStateMx.Unlock()
+	m.connState.Reset() //closed conns are gone
+	for target, byState := range counts {
+		for _, st := range states {
+			m.connState.With(prometheus.Labels{LabelTarget: target, LabelState: st.String()}).
+				Set(float64(byState[st]))
+		}
+	}
+}
+
+func callStateFromContext(ctx context.Context) *callState {
+	ret, _ := ctx.Value(callStateCtxKey{}).(*callState)
+	return ret
+}
+
+func (c *callState) attempt() {
+	atomic.AddInt32(&c.attempts, 1)
+}
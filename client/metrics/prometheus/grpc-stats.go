@@ -0,0 +1,103 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	clientStatsHandler ClientMetrics
+
+	rpcStateCtxKey struct{}
+
+	rpcState struct {
+		labels prometheus.Labels
+	}
+
+	connStateCtxKey struct{}
+)
+
+var _ stats.Handler = (*clientStatsHandler)(nil)
+
+//TagRPC impl stats.Handler
+func (h *clientStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	var mi conventions.GrpcMethodInfo
+	if mi.Init(info.FullMethodName) != nil {
+		return ctx
+	}
+	target := UnknownTarget
+	if call := callStateFromContext(ctx); call != nil {
+		call.attempt()
+		target = call.target
+	}
+	return context.WithValue(ctx, rpcStateCtxKey{}, &rpcState{
+		labels: prometheus.Labels{
+			LabelTarget:  target,
+			LabelService: mi.ServiceFQN,
+			LabelMethod:  mi.Method,
+		},
+	})
+}
+
+//HandleRPC impl stats.Handler
+func (h *clientStatsHandler) HandleRPC(ctx context.Context, stat stats.RPCStats) {
+	if !stat.IsClient() {
+		return
+	}
+	state, _ := ctx.Value(rpcStateCtxKey{}).(*rpcState)
+	if state == nil {
+		return
+	}
+	switch t := stat.(type) {
+	case *stats.Begin:
+		h.started.With(state.labels).Inc()
+	case *stats.End:
+		h.responseTime.With(state.labels).
+			Observe(float64(t.EndTime.Sub(t.BeginTime)) / float64(time.Millisecond))
+		h.finished.With(state.with(LabelGRPCCode, status.Code(t.Error).String())).Inc()
+	case *stats.InPayload:
+		h.messages.With(state.with(LabelState, Received)).Inc()
+	case *stats.OutPayload:
+		h.messages.With(state.with(LabelState, Sent)).Inc()
+	}
+}
+
+//TagConn impl stats.Handler
+func (h *clientStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connStateCtxKey{}, info)
+}
+
+//HandleConn impl stats.Handler
+func (h *clientStatsHandler) HandleConn(ctx context.Context, stat stats.ConnStats) {
+	if !stat.IsClient() {
+		return
+	}
+	info, _ := ctx.Value(connStateCtxKey{}).(*stats.ConnTagInfo)
+	if info == nil || info.RemoteAddr == nil {
+		return
+	}
+	g := h.connections.With(prometheus.Labels{
+		LabelRemoteAddr: fmt.Sprintf("%s://%s", info.RemoteAddr.Network(), info.RemoteAddr.String()),
+	})
+	switch stat.(type) {
+	case *stats.ConnBegin:
+		g.Inc()
+	case *stats.ConnEnd:
+		g.Dec()
+	}
+}
+
+func (s *rpcState) with(label, value string) prometheus.Labels {
+	ret := make(prometheus.Labels, len(s.labels)+1)
+	for k, v := range s.labels {
+		ret[k] = v
+	}
+	ret[label] = value
+	return ret
+}
@@ -24,6 +24,14 @@ const (
 	//semconv.NetPeerIPKey
 )
 
+const (
+	//RPCAttemptKey number of call attempt starting from 1
+	RPCAttemptKey = attribute.Key("rpc.attempt")
+
+	//RPCRetryDelayKey delay in milliseconds before next attempt of call
+	RPCRetryDelayKey = attribute.Key("rpc.retry_delay_ms")
+)
+
 const (
 	//NetPeerUnixSocketKey ...
 	NetPeerUnixSocketKey = attribute.Key("net.peer.unix_socket")
@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//NewRotatedFile makes file sink; when file size exceeds maxSize it is renamed to 'fileName.1',
+//older ones are shifted to 'fileName.2' ... 'fileName.<maxBackups>' and the oldest is removed
+func NewRotatedFile(fileName string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	const api = "NewRotatedFile"
+	if maxSize <= 0 {
+		return nil, errors.Errorf("%s: max size must be positive", api)
+	}
+	ret := &rotatedFile{
+		fileName:   fileName,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := ret.open(); err != nil {
+		return nil, errors.Wrap(err, api)
+	}
+	return ret, nil
+}
+
+type rotatedFile struct {
+	mx         sync.Mutex
+	fileName   string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+//Write impl io.Writer; if rotation fails data goes on to be written to current file and rotation error is returned
+func (rf *rotatedFile) Write(p []byte) (int, error) {
+	rf.mx.Lock()
+	defer rf.mx.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		rotateErr = rf.rotate()
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+//Close impl io.Closer
+func (rf *rotatedFile) Close() error {
+	rf.mx.Lock()
+	defer rf.mx.Unlock()
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+func (rf *rotatedFile) open() error {
+	f, size, err := openAppend(rf.fileName)
+	if err == nil {
+		rf.f, rf.size = f, size
+	}
+	return err
+}
+
+//rotate current file is kept until the new one is opened so logging survives rotation failures
+func (rf *rotatedFile) rotate() error {
+	backup := func(i int) string {
+		return fmt.Sprintf("%s.%v", rf.fileName, i)
+	}
+	if rf.maxBackups > 0 {
+		_ = os.Remove(backup(rf.maxBackups))
+		for i := rf.maxBackups - 1; i > 0; i-- {
+			_ = os.Rename(backup(i), backup(i+1))
+		}
+		if err := os.Rename(rf.fileName, backup(1)); err != nil {
+			return errors.Wrap(err, "rotate")
+		}
+	} else if err := os.Remove(rf.fileName); err != nil {
+		return errors.Wrap(err, "rotate")
+	}
+	f, size, err := openAppend(rf.fileName)
+	if err != nil {
+		return errors.Wrap(err, "rotate")
+	}
+	old := rf.f
+	rf.f, rf.size = f, size
+	return errors.Wrap(old.Close(), "rotate")
+}
+
+func openAppend(fileName string) (*os.File, int64, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	var st os.FileInfo
+	if st, err = f.Stat(); err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
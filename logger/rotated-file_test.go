@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotated")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	fileName := filepath.Join(dir, "audit.log")
+	w, err := NewRotatedFile(fileName, 10, 2)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, s := range []string{"1111111\n", "2222222\n", "3333333\n", "4444444\n"} {
+		_, err = w.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	expected := map[string]string{
+		fileName:        "4444444\n",
+		fileName + ".1": "3333333\n",
+		fileName + ".2": "2222222\n",
+	}
+	for f, s := range expected {
+		b, e := ioutil.ReadFile(f)
+		if assert.NoError(t, e) {
+			assert.Equal(t, s, string(b))
+		}
+	}
+	_, err = os.Stat(fileName + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotatedFile_RenameFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotated")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	fileName := filepath.Join(dir, "audit.log")
+	w, err := NewRotatedFile(fileName, 10, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer w.Close() //nolint
+	//backup path is not empty dir so file can not be renamed to it
+	if err = os.MkdirAll(filepath.Join(fileName+".1", "busy"), 0755); !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte("1111111\n"))
+	assert.NoError(t, err)
+	var n int
+	n, err = w.Write([]byte("2222222\n"))
+	assert.Error(t, err)
+	assert.Equal(t, 8, n)
+
+	if err = os.RemoveAll(fileName + ".1"); !assert.NoError(t, err) {
+		return
+	}
+	_, err = w.Write([]byte("3333333\n"))
+	assert.NoError(t, err)
+	expected := map[string]string{
+		fileName:        "3333333\n",
+		fileName + ".1": "1111111\n2222222\n",
+	}
+	for f, s := range expected {
+		b, e := ioutil.ReadFile(f)
+		if assert.NoError(t, e) {
+			assert.Equal(t, s, string(b))
+		}
+	}
+}
@@ -17,6 +17,11 @@ const (
 	UserAgentHeader = "user-agent"
 )
 
+const (
+	//RetryPushbackHeader server pushback in milliseconds; client should not retry call before it elapses
+	RetryPushbackHeader = "grpc-retry-pushback-ms"
+)
+
 const (
 	//LoggerLevelHeader notes to change log level in current context of operation
 	LoggerLevelHeader = SysHeaderPrefix + "log-lvl"
@@ -26,6 +31,24 @@ const (
 
 	//AppVersionHeader holds application version for incoming outgoing requests
 	AppVersionHeader = SysHeaderPrefix + "app-ver"
+
+	//AppInstanceHeader holds application instance ID for incoming outgoing requests
+	AppInstanceHeader = SysHeaderPrefix + "app-instance"
+
+	//APIKeyHeader holds static API key of caller
+	APIKeyHeader = SysHeaderPrefix + "api-key"
+
+	//PeerIdentityHeader holds identity of client certificate forwarded by gateway
+	PeerIdentityHeader = SysHeaderPrefix + "peer-identity"
+
+	//TimeoutHeader holds call timeout in grpc-timeout form "1500m" or as Go duration "1.5s";
+	//it is useful for HTTP clients of gateway
+	TimeoutHeader = SysHeaderPrefix + "timeout"
+)
+
+const (
+	//AuthorizationHeader holds bearer token
+	AuthorizationHeader = "authorization"
 )
 
 //ClientName user agent extractor
@@ -57,7 +80,7 @@ func (clientNameExtractor) mdIncoming(ctx context.Context) metadata.MD {
 }
 
 func (clientNameExtractor) mdOutgoing(ctx context.Context) metadata.MD {
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
 		return md
 	}
 	return nil
@@ -0,0 +1,291 @@
+package jsonview
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/thataway/common-lib/pkg/jsonview/options"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+//RedactedValue replaces values of sensitive string and bytes fields
+const RedactedValue = "[REDACTED]"
+
+//Redactor hides sensitive fields of proto messages; field is sensitive if it has option
+//`(sbr.jsonview.sensitive) = true` from "jsonview/options/redact.proto" or `debug_redact = true`,
+//or it is listed by full name like "pkg.Message.field" or by path from root message like "credentials.password";
+//nested messages, repeated fields and maps are redacted recursively; messages are packed into google.protobuf.Any
+//are unpacked by resolver and redacted too, Any is cleared if its type is not resolved
+type Redactor struct {
+	fields   map[string]struct{}
+	resolver TypeResolver
+}
+
+//TypeResolver resolves types of messages are packed into google.protobuf.Any
+type TypeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+//DefaultRedactor hides fields are marked by options; it is used by Redacted; replace it at start if need
+var DefaultRedactor = NewRedactor()
+
+//NewRedactor makes redactor; fields are full names or paths of sensitive fields
+func NewRedactor(fields ...string) *Redactor {
+	ret := &Redactor{
+		fields:   make(map[string]struct{}),
+		resolver: protoregistry.GlobalTypes,
+	}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); len(f) > 0 {
+			ret.fields[f] = struct{}{}
+		}
+	}
+	return ret
+}
+
+//WithResolver gives copy of redactor resolves Any types by resolver instead of protoregistry.GlobalTypes
+func (r *Redactor) WithResolver(resolver TypeResolver) *Redactor {
+	ret := *r
+	ret.resolver = resolver
+	return &ret
+}
+
+//Redacted is like Marshaler but proto messages are redacted by DefaultRedactor
+func Redacted(d interface{}) json.Marshaler {
+	return DefaultRedactor.Marshaler(d)
+}
+
+//Redact gives copy of message with sensitive fields are masked; message is given as is if it has nothing to hide
+func (r *Redactor) Redact(m proto.Message) proto.Message {
+	if m == nil {
+		return nil
+	}
+	if len(r.fields) == 0 && !hasSensitiveOptions(m.ProtoReflect().Descriptor()) {
+		return m
+	}
+	ret := proto.Clone(m)
+	r.redact(ret.ProtoReflect(), "")
+	return ret
+}
+
+//Marshaler is like Marshaler but proto messages are redacted
+func (r *Redactor) Marshaler(d interface{}) json.Marshaler {
+	if m, ok := d.(proto.Message); ok && m != nil {
+		return marshaler(func() ([]byte, error) {
+			return protojson.MarshalOptions{AllowPartial: true, Resolver: r.resolver}.Marshal(r.Redact(m))
+		})
+	}
+	return Marshaler(d)
+}
+
+func (r *Redactor) isSensitive(fd protoreflect.FieldDescriptor, path string) bool {
+	if _, ok := r.fields[path]; ok {
+		return true
+	}
+	if _, ok := r.fields[string(fd.FullName())]; ok {
+		return true
+	}
+	return isSensitiveByOptions(fd)
+}
+
+func (r *Redactor) redact(m protoreflect.Message, prefix string) {
+	if m.Descriptor().FullName() == anyFullName {
+		r.redactAny(m, prefix)
+		return
+	}
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		path := prefix + string(fd.Name())
+		if r.isSensitive(fd, path) {
+			maskField(m, fd)
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				m.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					r.redact(v.Message(), path+".")
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				lst := m.Mutable(fd).List()
+				for i := 0; i < lst.Len(); i++ {
+					r.redact(lst.Get(i).Message(), path+".")
+				}
+			}
+		case fd.Message() != nil:
+			r.redact(m.Mutable(fd).Message(), path+".")
+		}
+	}
+}
+
+const anyFullName protoreflect.FullName = "google.protobuf.Any"
+
+//redactAny packed message has the same path as Any
+func (r *Redactor) redactAny(m protoreflect.Message, prefix string) {
+	fields := m.Descriptor().Fields()
+	typeURL, value := fields.ByName("type_url"), fields.ByName("value")
+	url := m.Get(typeURL).String()
+	if len(url) == 0 {
+		m.Clear(value)
+		return
+	}
+	mt, err := r.resolver.FindMessageByURL(url)
+	var packed protoreflect.Message
+	if err == nil {
+		packed = mt.New()
+		err = proto.UnmarshalOptions{AllowPartial: true, Resolver: r.resolver}.
+			Unmarshal(m.Get(value).Bytes(), packed.Interface())
+	}
+	var b []byte
+	if err == nil {
+		r.redact(packed, prefix)
+		b, err = proto.MarshalOptions{AllowPartial: true, Deterministic: true}.Marshal(packed.Interface())
+	}
+	if err != nil { //it is dropped because we can not look into
+		m.Clear(typeURL)
+		m.Clear(value)
+		return
+	}
+	m.Set(value, protoreflect.ValueOfBytes(b))
+}
+
+func maskedValue(kind protoreflect.Kind) (protoreflect.Value, bool) {
+	switch kind {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(RedactedValue), true
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(RedactedValue)), true
+	}
+	return protoreflect.Value{}, false
+}
+
+func maskField(m protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	switch {
+	case fd.IsMap():
+		v, ok := maskedValue(fd.MapValue().Kind())
+		if !ok {
+			m.Clear(fd)
+			return
+		}
+		mp := m.Mutable(fd).Map()
+		var keys []protoreflect.MapKey
+		mp.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		for _, k := range keys {
+			mp.Set(k, v)
+		}
+	case fd.IsList():
+		v, ok := maskedValue(fd.Kind())
+		if !ok {
+			m.Clear(fd)
+			return
+		}
+		lst := m.Mutable(fd).List()
+		for i := 0; i < lst.Len(); i++ {
+			lst.Set(i, v)
+		}
+	default:
+		if v, ok := maskedValue(fd.Kind()); ok {
+			m.Set(fd, v)
+		} else {
+			m.Clear(fd)
+		}
+	}
+}
+
+var (
+	sensitiveFieldsCache sync.Map
+	sensitiveTypesCache  sync.Map
+)
+
+//hasSensitiveOptions checks if message or any nested one has fields are marked by options or it is Any
+func hasSensitiveOptions(md protoreflect.MessageDescriptor) bool {
+	if v, ok := sensitiveTypesCache.Load(md.FullName()); ok {
+		return v.(bool)
+	}
+	ret := lookupSensitiveOptions(md, make(map[protoreflect.FullName]bool))
+	sensitiveTypesCache.Store(md.FullName(), ret)
+	return ret
+}
+
+func lookupSensitiveOptions(md protoreflect.MessageDescriptor, visited map[protoreflect.FullName]bool) bool {
+	if visited[md.FullName()] {
+		return false
+	}
+	visited[md.FullName()] = true
+	if md.FullName() == anyFullName {
+		return true //packed message may have sensitive fields
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if isSensitiveByOptions(fd) {
+			return true
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if nested := fd.Message(); nested != nil && lookupSensitiveOptions(nested, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+//isSensitiveByOptions checks `(sbr.jsonview.sensitive)` and `debug_redact` field options;
+//descriptorpb we use has no `debug_redact` yet and extension may be unresolved
+//when options are parsed, so they are looked for in unknown fields of options too
+func isSensitiveByOptions(fd protoreflect.FieldDescriptor) bool {
+	if v, ok := sensitiveFieldsCache.Load(fd); ok {
+		return v.(bool)
+	}
+	var ret bool
+	if opts, _ := fd.Options().(*descriptorpb.FieldOptions); opts != nil {
+		ret, _ = proto.GetExtension(opts, options.E_Sensitive).(bool)
+		const debugRedactField = 16
+		ret = ret || boolInUnknown(opts.ProtoReflect().GetUnknown(), debugRedactField, protowire.Number(options.E_Sensitive.Field))
+	}
+	sensitiveFieldsCache.Store(fd, ret)
+	return ret
+}
+
+func boolInUnknown(b []byte, fields ...protowire.Number) bool {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+		if typ == protowire.VarintType {
+			for _, f := range fields {
+				if num != f {
+					continue
+				}
+				if v, n1 := protowire.ConsumeVarint(b); n1 >= 0 && v != 0 {
+					return true
+				}
+			}
+		}
+		if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return false
+}
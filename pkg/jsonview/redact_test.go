@@ -0,0 +1,199 @@
+package jsonview
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/jsonview/options"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/anypb" //registers google/protobuf/any.proto
+)
+
+func makeTestRedactDescriptor(t *testing.T) protoreflect.FileDescriptor {
+	sensitive := func() *descriptorpb.FieldOptions {
+		ret := new(descriptorpb.FieldOptions)
+		proto.SetExtension(ret, options.E_Sensitive, true)
+		return ret
+	}
+	debugRedact := func() *descriptorpb.FieldOptions {
+		ret := new(descriptorpb.FieldOptions)
+		b := protowire.AppendTag(nil, 16, protowire.VarintType)
+		ret.ProtoReflect().SetUnknown(protowire.AppendVarint(b, 1))
+		return ret
+	}
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string,
+		repeated bool, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		ret := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Options:  opts,
+		}
+		if repeated {
+			ret.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}
+		if len(typeName) > 0 {
+			ret.TypeName = proto.String(typeName)
+		}
+		return ret
+	}
+	const (
+		tString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		tMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("jsonview/redact_test.proto"),
+		Package:    proto.String("test.redact"),
+		Dependency: []string{"jsonview/options/redact.proto", "google/protobuf/any.proto"},
+		Syntax:     proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Secret"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("token", 1, tString, "", false, sensitive()),
+					field("note", 2, tString, "", false, nil),
+				},
+			},
+			{
+				Name: proto.String("Root"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("password", 1, tString, "", false, debugRedact()),
+					field("secret", 2, tMessage, ".test.redact.Secret", false, nil),
+					field("secrets", 3, tMessage, ".test.redact.Secret", true, nil),
+					field("by_name", 4, tMessage, ".test.redact.Root.ByNameEntry", true, nil),
+					field("pins", 5, tString, "", true, sensitive()),
+					field("login", 6, tString, "", false, nil),
+					field("hint", 7, tString, "", false, nil),
+					field("details", 8, tMessage, ".google.protobuf.Any", true, nil),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("ByNameEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, tString, "", false, nil),
+						field("value", 2, tMessage, ".test.redact.Secret", false, nil),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+	ret, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return ret
+}
+
+func TestRedactor(t *testing.T) {
+	fd := makeTestRedactDescriptor(t)
+	rootDesc, secretDesc := fd.Messages().ByName("Root"), fd.Messages().ByName("Secret")
+	newSecret := func(token, note string) protoreflect.Value {
+		m := dynamicpb.NewMessage(secretDesc)
+		m.Set(secretDesc.Fields().ByName("token"), protoreflect.ValueOfString(token))
+		m.Set(secretDesc.Fields().ByName("note"), protoreflect.ValueOfString(note))
+		return protoreflect.ValueOfMessage(m)
+	}
+	root := dynamicpb.NewMessage(rootDesc)
+	fields := rootDesc.Fields()
+	root.Set(fields.ByName("password"), protoreflect.ValueOfString("pwd"))
+	root.Set(fields.ByName("secret"), newSecret("t1", "n1"))
+	root.Mutable(fields.ByName("secrets")).List().Append(newSecret("t2", "n2"))
+	root.Mutable(fields.ByName("by_name")).Map().Set(protoreflect.ValueOfString("k").MapKey(), newSecret("t3", "n3"))
+	root.Mutable(fields.ByName("pins")).List().Append(protoreflect.ValueOfString("1234"))
+	root.Set(fields.ByName("login"), protoreflect.ValueOfString("user"))
+	root.Set(fields.ByName("hint"), protoreflect.ValueOfString("my hint"))
+
+	type (
+		secret struct {
+			Token string `json:"token"`
+			Note  string `json:"note"`
+		}
+		view struct {
+			Password string            `json:"password"`
+			Secret   secret            `json:"secret"`
+			Secrets  []secret          `json:"secrets"`
+			ByName   map[string]secret `json:"by_name"`
+			Pins     []string          `json:"pins"`
+			Login    string            `json:"login"`
+			Hint     string            `json:"hint"`
+		}
+	)
+	decode := func(m json.Marshaler) view {
+		var ret view
+		b, err := m.MarshalJSON()
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(b, &ret))
+		return ret
+	}
+
+	v := decode(Redacted(root))
+	assert.Equal(t, RedactedValue, v.Password)
+	assert.Equal(t, secret{Token: RedactedValue, Note: "n1"}, v.Secret)
+	assert.Equal(t, []secret{{Token: RedactedValue, Note: "n2"}}, v.Secrets)
+	assert.Equal(t, map[string]secret{"k": {Token: RedactedValue, Note: "n3"}}, v.ByName)
+	assert.Equal(t, []string{RedactedValue}, v.Pins)
+	assert.Equal(t, "user", v.Login)
+	assert.Equal(t, "my hint", v.Hint)
+
+	v = decode(NewRedactor("test.redact.Root.hint", "secret.note").Marshaler(root))
+	assert.Equal(t, RedactedValue, v.Hint)
+	assert.Equal(t, secret{Token: RedactedValue, Note: RedactedValue}, v.Secret)
+	assert.Equal(t, []secret{{Token: RedactedValue, Note: "n2"}}, v.Secrets)
+
+	//source message is intact
+	assert.Equal(t, "pwd", root.Get(fields.ByName("password")).String())
+	assert.Equal(t, "t1", root.Get(fields.ByName("secret")).Message().Get(secretDesc.Fields().ByName("token")).String())
+}
+
+func TestRedactorAny(t *testing.T) {
+	fd := makeTestRedactDescriptor(t)
+	rootDesc, secretDesc := fd.Messages().ByName("Root"), fd.Messages().ByName("Secret")
+	secretMsg := dynamicpb.NewMessage(secretDesc)
+	secretMsg.Set(secretDesc.Fields().ByName("token"), protoreflect.ValueOfString("t4"))
+	secretMsg.Set(secretDesc.Fields().ByName("note"), protoreflect.ValueOfString("n4"))
+	packed, err := proto.Marshal(secretMsg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	root := dynamicpb.NewMessage(rootDesc)
+	details := root.Mutable(rootDesc.Fields().ByName("details")).List()
+	anyMsg := details.NewElement().Message()
+	anyFields := anyMsg.Descriptor().Fields()
+	anyMsg.Set(anyFields.ByName("type_url"), protoreflect.ValueOfString("type.googleapis.com/test.redact.Secret"))
+	anyMsg.Set(anyFields.ByName("value"), protoreflect.ValueOfBytes(packed))
+	details.Append(protoreflect.ValueOfMessage(anyMsg))
+
+	type view struct {
+		Details []map[string]string `json:"details"`
+	}
+	decode := func(m json.Marshaler) view {
+		var ret view
+		b, e := m.MarshalJSON()
+		assert.NoError(t, e)
+		assert.NoError(t, json.Unmarshal(b, &ret))
+		return ret
+	}
+	types := new(protoregistry.Types)
+	if err = types.RegisterMessage(dynamicpb.NewMessageType(secretDesc)); !assert.NoError(t, err) {
+		return
+	}
+	v := decode(NewRedactor("details.note").WithResolver(types).Marshaler(root))
+	assert.Equal(t, []map[string]string{{
+		"@type": "type.googleapis.com/test.redact.Secret",
+		"token": RedactedValue,
+		"note":  RedactedValue,
+	}}, v.Details)
+
+	//packed message of unknown type is dropped
+	v = decode(Redacted(root))
+	assert.Equal(t, []map[string]string{{}}, v.Details)
+}
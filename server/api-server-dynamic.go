@@ -0,0 +1,566 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-openapi/spec"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/server/swagger_ui"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//APIServiceImpl optional to APIService interface; it gives GRPC implementation of service added on the fly
+//when APIService itself does not implement handler type of its grpc.ServiceDesc
+type APIServiceImpl interface {
+	ServiceImpl() interface{}
+}
+
+//APIServiceDocs optional to APIService interface; docs of services added on the fly are composed into server docs
+type APIServiceDocs interface {
+	GetDocs() (*SwaggerSpec, error)
+}
+
+//WithDynamicServices lets to add and remove services on running server
+func WithDynamicServices() APIServerOption {
+	return serverOptApplier(func(srv *APIServer) error {
+		if srv.dynamic == nil {
+			srv.dynamic = &dynamicServices{
+				services: make(map[string]*dynamicService),
+				bindings: make(map[uintptr]*dynamicBinding),
+			}
+		}
+		return nil
+	})
+}
+
+//AddService adds service on the fly; server should be made with WithDynamicServices option
+func (srv *APIServer) AddService(service APIService) error {
+	const api = "APIServer.AddService"
+	if srv.dynamic == nil {
+		return errors.Errorf("%s: server does not support dynamic services", api)
+	}
+	d := service.Description()
+	if _, isIn := srv.apis[d.ServiceName]; isIn {
+		return errors.Errorf("%s: service '%s' is always in", api, d.ServiceName)
+	}
+	s, err := newDynamicService(service)
+	if err != nil {
+		return errors.Wrap(err, api)
+	}
+	if err = srv.dynamic.add(s); err != nil {
+		return errors.Wrap(err, api)
+	}
+	if srv.health != nil {
+		srv.health.addService(d.ServiceName, service)
+	}
+	return nil
+}
+
+//RemoveService removes service been added on the fly
+func (srv *APIServer) RemoveService(serviceName string) error {
+	const api = "APIServer.RemoveService"
+	if srv.dynamic == nil {
+		return errors.Errorf("%s: server does not support dynamic services", api)
+	}
+	if err := srv.dynamic.remove(serviceName); err != nil {
+		return errors.Wrap(err, api)
+	}
+	if srv.health != nil {
+		srv.health.removeService(serviceName)
+	}
+	return nil
+}
+
+//EnableService enables or disables service been added on the fly; disabled service responds with Unavailable
+func (srv *APIServer) EnableService(serviceName string, enable bool) error {
+	const api = "APIServer.EnableService"
+	if srv.dynamic == nil {
+		return errors.Errorf("%s: server does not support dynamic services", api)
+	}
+	if err := srv.dynamic.enable(serviceName, enable); err != nil {
+		return errors.Wrap(err, api)
+	}
+	if srv.health != nil {
+		srv.health.enableService(serviceName, enable)
+	}
+	return nil
+}
+
+var (
+	_ = WithDynamicServices
+)
+
+type (
+	dynamicService struct {
+		api     APIService
+		impl    interface{}
+		enabled bool
+		docs    *SwaggerSpec
+		methods map[string]grpc.MethodDesc
+		streams map[string]grpc.StreamDesc
+	}
+
+	dynamicBinding struct {
+		ctx       context.Context
+		gwOptions []runtime.ServeMuxOption
+		gwProxy   *grpc.ClientConn
+		gateways  map[string]*runtime.ServeMux
+		running   bool
+	}
+
+	dynamicServices struct {
+		mx               sync.RWMutex
+		services         map[string]*dynamicService
+		bindings         map[uintptr]*dynamicBinding
+		docsVersion      uint64
+		unaryInterceptor grpc.UnaryServerInterceptor
+	}
+
+	//gatewayRouteMark it is set by gateway metadata annotator when gateway has route for request
+	gatewayRouteMark struct {
+		routed int32
+	}
+
+	gatewayRouteMarkCtxKey struct{}
+
+	//gatewayRouteProbe holds response until it is known if gateway has route for request;
+	//response of gateway has no route is dropped
+	gatewayRouteProbe struct {
+		http.ResponseWriter
+		mark      *gatewayRouteMark
+		header    http.Header
+		decided   bool
+		notRouted bool
+	}
+
+	dynamicGateway struct {
+		static  http.Handler
+		dynamic *dynamicServices
+		runID   uintptr
+	}
+
+	dynamicDocs struct {
+		dynamic *dynamicServices
+		base    *SwaggerSpec
+		host    string
+
+		mx      sync.Mutex
+		version uint64
+		handler http.Handler
+	}
+)
+
+func newDynamicService(service APIService) (*dynamicService, error) {
+	desc := service.Description()
+	ret := &dynamicService{
+		api:     service,
+		impl:    service,
+		methods: make(map[string]grpc.MethodDesc),
+		streams: make(map[string]grpc.StreamDesc),
+	}
+	if p, _ := service.(APIServiceImpl); p != nil {
+		ret.impl = p.ServiceImpl()
+	}
+	if desc.HandlerType != nil {
+		ht := reflect.TypeOf(desc.HandlerType).Elem()
+		if st := reflect.TypeOf(ret.impl); st == nil || !st.Implements(ht) {
+			return nil, errors.Errorf("service '%s': implementation %v does not satisfy %v",
+				desc.ServiceName, st, ht)
+		}
+	}
+	for _, m := range desc.Methods {
+		ret.methods[m.MethodName] = m
+	}
+	for _, s := range desc.Streams {
+		ret.streams[s.StreamName] = s
+	}
+	if p, _ := service.(APIServiceDocs); p != nil {
+		docs, err := p.GetDocs()
+		if err != nil {
+			return nil, errors.Wrapf(err, "service '%s': get docs", desc.ServiceName)
+		}
+		ret.docs = docs
+	}
+	ret.enabled = true
+	return ret, nil
+}
+
+func (ds *dynamicServices) add(s *dynamicService) error {
+	running, err := ds.addLocked(s)
+	if f, _ := s.api.(APIServiceOnStartEvent); f != nil && running && err == nil {
+		f.OnStart()
+	}
+	return err
+}
+
+func (ds *dynamicServices) addLocked(s *dynamicService) (running bool, err error) {
+	name := s.api.Description().ServiceName
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	if _, isIn := ds.services[name]; isIn {
+		return false, errors.Errorf("service '%s' is always in", name)
+	}
+	for _, b := range ds.bindings {
+		if err = b.registerGateway(name, s); err != nil {
+			for _, b1 := range ds.bindings {
+				delete(b1.gateways, name)
+			}
+			return false, err
+		}
+		running = running || b.running
+	}
+	ds.services[name] = s
+	if s.docs != nil {
+		ds.docsVersion++
+	}
+	return running, nil
+}
+
+func (ds *dynamicServices) remove(name string) error {
+	s, running, err := ds.removeLocked(name)
+	if err != nil {
+		return err
+	}
+	if f, _ := s.api.(APIServiceOnStopEvent); f != nil && running {
+		f.OnStop()
+	}
+	return nil
+}
+
+func (ds *dynamicServices) removeLocked(name string) (s *dynamicService, running bool, err error) {
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	var isIn bool
+	if s, isIn = ds.services[name]; !isIn {
+		return nil, false, errors.Errorf("service '%s' is not found", name)
+	}
+	delete(ds.services, name)
+	for _, b := range ds.bindings {
+		delete(b.gateways, name)
+		running = running || b.running
+	}
+	if s.docs != nil {
+		ds.docsVersion++
+	}
+	return s, running, nil
+}
+
+func (ds *dynamicServices) enable(name string, enable bool) error {
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	s, isIn := ds.services[name]
+	if !isIn {
+		return errors.Errorf("service '%s' is not found", name)
+	}
+	s.enabled = enable
+	return nil
+}
+
+func (ds *dynamicServices) attach(runID uintptr, b *dynamicBinding) error {
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	b.gateways = make(map[string]*runtime.ServeMux)
+	for name, s := range ds.services {
+		if err := b.registerGateway(name, s); err != nil {
+			return err
+		}
+	}
+	ds.bindings[runID] = b
+	return nil
+}
+
+func (ds *dynamicServices) detach(runID uintptr) {
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	delete(ds.bindings, runID)
+}
+
+func (ds *dynamicServices) notifyRunning(runID uintptr, running bool) {
+	for _, f := range ds.setRunningLocked(runID, running) {
+		f()
+	}
+}
+
+//setRunningLocked gives OnStart or OnStop callbacks of services; they are called when lock is released
+func (ds *dynamicServices) setRunningLocked(runID uintptr, running bool) []func() {
+	ds.mx.Lock()
+	defer ds.mx.Unlock()
+	b := ds.bindings[runID]
+	if b == nil || b.running == running {
+		return nil
+	}
+	for _, other := range ds.bindings {
+		if other != b && other.running {
+			b.running = running
+			return nil
+		}
+	}
+	b.running = running
+	var ret []func()
+	for _, s := range ds.services {
+		if running {
+			if f, _ := s.api.(APIServiceOnStartEvent); f != nil {
+				ret = append(ret, f.OnStart)
+			}
+		} else if f, _ := s.api.(APIServiceOnStopEvent); f != nil {
+			ret = append(ret, f.OnStop)
+		}
+	}
+	return ret
+}
+
+//streamInterceptor it goes first in chain of stream interceptors; unary calls to services been added on the fly
+//skip stream interceptors here because handleStream passes them through unary interceptors
+func (ds *dynamicServices) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var mi conventions.GrpcMethodInfo
+	if mi.Init(info.FullMethod) == nil {
+		ds.mx.RLock()
+		s := ds.services[mi.ServiceFQN]
+		ds.mx.RUnlock()
+		if s != nil {
+			if _, isUnary := s.methods[mi.Method]; isUnary {
+				return ds.handleStream(srv, ss)
+			}
+		}
+	}
+	return handler(srv, ss)
+}
+
+//handleStream it serves calls to services been added on the fly as grpc.UnknownServiceHandler
+func (ds *dynamicServices) handleStream(_ interface{}, stream grpc.ServerStream) error {
+	fullMethod, _ := grpc.MethodFromServerStream(stream)
+	var mi conventions.GrpcMethodInfo
+	if mi.Init(fullMethod) != nil {
+		return status.Errorf(codes.Unimplemented, "unknown method '%s'", fullMethod)
+	}
+	ds.mx.RLock()
+	s := ds.services[mi.ServiceFQN]
+	var enabled bool
+	if s != nil {
+		enabled = s.enabled
+	}
+	ds.mx.RUnlock()
+	if s == nil {
+		return status.Errorf(codes.Unimplemented, "unknown service '%s'", mi.ServiceFQN)
+	}
+	if !enabled {
+		return status.Errorf(codes.Unavailable, "service '%s' is not enabled", mi.ServiceFQN)
+	}
+	if m, ok := s.methods[mi.Method]; ok {
+		resp, err := m.Handler(s.impl, stream.Context(), stream.RecvMsg, ds.unaryInterceptor)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(resp)
+	}
+	if sd, ok := s.streams[mi.Method]; ok {
+		return sd.Handler(s.impl, stream)
+	}
+	return status.Errorf(codes.Unimplemented, "unknown method '%s' for service '%s'", mi.Method, mi.ServiceFQN)
+}
+
+//chainUnaryInterceptors makes one interceptor of chain like grpc.ChainUnaryInterceptor does; nil if chain is empty
+func chainUnaryInterceptors(chain []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if len(chain) == 0 {
+		return nil
+	}
+	chain = append([]grpc.UnaryServerInterceptor(nil), chain...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(chain) - 1; i >= 0; i-- {
+			interceptor, h := chain[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+func (ds *dynamicServices) gateways(runID uintptr) []http.Handler {
+	ds.mx.RLock()
+	defer ds.mx.RUnlock()
+	b := ds.bindings[runID]
+	if b == nil {
+		return nil
+	}
+	names := make([]string, 0, len(b.gateways))
+	for name := range b.gateways {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]http.Handler, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, b.gateways[name])
+	}
+	return ret
+}
+
+func (ds *dynamicServices) docs() (uint64, []*SwaggerSpec) {
+	ds.mx.RLock()
+	defer ds.mx.RUnlock()
+	names := make([]string, 0, len(ds.services))
+	for name, s := range ds.services {
+		if s.docs != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ret := make([]*SwaggerSpec, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, ds.services[name].docs)
+	}
+	return ds.docsVersion, ret
+}
+
+func (b *dynamicBinding) registerGateway(name string, s *dynamicService) error {
+	pxy, _ := s.api.(APIGatewayProxy)
+	if pxy == nil {
+		return nil
+	}
+	gw := runtime.NewServeMux(b.gwOptions...)
+	if err := pxy.RegisterProxyGW(b.ctx, gw, b.gwProxy); err != nil {
+		return errors.Wrapf(err, "unable register proxy gateway to service '%s'", name)
+	}
+	b.gateways[name] = gw
+	return nil
+}
+
+//markGatewayRouted notes gateway has route for request; it is called by gateway metadata annotator
+func markGatewayRouted(ctx context.Context) {
+	if m, _ := ctx.Value(gatewayRouteMarkCtxKey{}).(*gatewayRouteMark); m != nil {
+		atomic.StoreInt32(&m.routed, 1)
+	}
+}
+
+func (m *gatewayRouteMark) isRouted() bool {
+	return atomic.LoadInt32(&m.routed) != 0
+}
+
+//Header impl http.ResponseWriter
+func (p *gatewayRouteProbe) Header() http.Header {
+	if p.decided && !p.notRouted {
+		return p.ResponseWriter.Header()
+	}
+	return p.header
+}
+
+//WriteHeader impl http.ResponseWriter
+func (p *gatewayRouteProbe) WriteHeader(code int) {
+	if p.decide() {
+		p.ResponseWriter.WriteHeader(code)
+	}
+}
+
+//Write impl http.ResponseWriter
+func (p *gatewayRouteProbe) Write(b []byte) (int, error) {
+	if p.decide() {
+		return p.ResponseWriter.Write(b)
+	}
+	return len(b), nil
+}
+
+//Flush impl http.Flusher
+func (p *gatewayRouteProbe) Flush() {
+	if p.decide() {
+		if f, _ := p.ResponseWriter.(http.Flusher); f != nil {
+			f.Flush()
+		}
+	}
+}
+
+//decide response goes through when gateway has route for request
+func (p *gatewayRouteProbe) decide() bool {
+	if !p.decided {
+		p.decided = true
+		if p.notRouted = !p.mark.isRouted(); !p.notRouted {
+			h := p.ResponseWriter.Header()
+			for k, v := range p.header {
+				h[k] = v
+			}
+		}
+	}
+	return !p.notRouted
+}
+
+func (gw *dynamicGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handlers []http.Handler
+	if gw.static != nil {
+		handlers = append(handlers, gw.static)
+	}
+	handlers = append(handlers, gw.dynamic.gateways(gw.runID)...)
+	if len(handlers) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	for _, h := range handlers {
+		mark := new(gatewayRouteMark)
+		probe := &gatewayRouteProbe{ResponseWriter: w, mark: mark, header: make(http.Header)}
+		h.ServeHTTP(probe, r.WithContext(context.WithValue(r.Context(), gatewayRouteMarkCtxKey{}, mark)))
+		if mark.isRouted() {
+			return
+		}
+	}
+	handlers[0].ServeHTTP(w, r) //routing error is given by routing error handler of gateway
+}
+
+func (h *dynamicDocs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, err := h.actualHandler()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (h *dynamicDocs) actualHandler() (http.Handler, error) {
+	version, docs := h.dynamic.docs()
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if h.handler != nil && h.version == version {
+		return h.handler, nil
+	}
+	if h.base != nil {
+		docs = append([]*SwaggerSpec{h.base}, docs...)
+	}
+	if len(docs) == 0 {
+		h.handler, h.version = nil, version
+		return nil, nil
+	}
+	primary, err := CloneSwaggerSpec(docs[0])
+	if err != nil {
+		return nil, err
+	}
+	if primary.Definitions == nil {
+		primary.Definitions = make(map[string]spec.Schema)
+	}
+	if primary.Paths == nil {
+		primary.Paths = new(spec.Paths)
+	}
+	if primary.Paths.Paths == nil {
+		primary.Paths.Paths = make(map[string]spec.PathItem)
+	}
+	if err = ComposeSwaggers(primary, docs[1:]...); err != nil {
+		return nil, err
+	}
+	primary.Host = h.host
+	var handler http.Handler
+	if handler, err = swagger_ui.NewHandler(primary); err != nil {
+		return nil, err
+	}
+	h.handler, h.version = handler, version
+	return handler, nil
+}
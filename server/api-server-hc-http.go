@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thataway/common-lib/server/health_check"
+)
+
+const (
+	//DefaultLivenessPath default HTTP path of liveness endpoint
+	DefaultLivenessPath = "/healthz"
+
+	//DefaultReadinessPath default HTTP path of readiness endpoint
+	DefaultReadinessPath = "/readyz"
+)
+
+type (
+	httpHealthProbes struct {
+		enabled       bool
+		livenessPath  string
+		readinessPath string
+	}
+
+	livenessHandler struct{}
+
+	readinessHandler struct {
+		registry func() HealthRegistry
+	}
+
+	readinessReport struct {
+		Status   string            `json:"status"`
+		Services map[string]string `json:"services,omitempty"`
+	}
+)
+
+func (livenessHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(readinessReport{Status: "alive"})
+}
+
+func (h readinessHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	report := readinessReport{Status: health_check.StatusServing.String()}
+	if reg := h.registry(); reg != nil {
+		statuses := reg.ServingStatuses()
+		report.Services = make(map[string]string, len(statuses))
+		for name, st := range statuses {
+			if len(name) == 0 {
+				report.Status = st.String()
+			} else {
+				report.Services[name] = st.String()
+			}
+		}
+	}
+	code := http.StatusOK
+	if report.Status != health_check.StatusServing.String() {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/thataway/common-lib/server/health_check"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 //HealthCheck optional to APIService interface
@@ -13,10 +16,68 @@ type HealthCheck interface {
 	HealthProbe(ctx context.Context) (*health_check.Response, error)
 }
 
+//HealthRegistry registry of services serving statuses
+type HealthRegistry interface {
+	//SetServingStatus sets serving status of service, it takes precedence over HealthProbe results;
+	//overall server status "" is aggregated and can not be set
+	SetServingStatus(service string, st health_check.ResponseStatus)
+	//ServingStatus gets serving status of service; "" means overall server status
+	ServingStatus(service string) (health_check.ResponseStatus, bool)
+	//ServingStatuses gets serving statuses of all known services including overall server status ""
+	ServingStatuses() map[string]health_check.ResponseStatus
+}
+
+const (
+	//DefaultHealthProbeInterval default interval to call HealthCheck.HealthProbe of services
+	DefaultHealthProbeInterval = 5 * time.Second
+
+	//DefaultHealthProbeTimeout default timeout of HealthCheck.HealthProbe call
+	DefaultHealthProbeTimeout = time.Second
+)
+
 type healthCheckService struct {
 	health_check.Unimplemented
-	services name2service
-	ready    atomic.Value
+	services      name2service
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+
+	mx         sync.Mutex
+	running    int
+	draining   bool
+	stopProbes func()
+	statuses   map[string]health_check.ResponseStatus
+	manual     map[string]struct{}
+	watchers   map[string]map[chan health_check.ResponseStatus]struct{}
+}
+
+var _ HealthRegistry = (*healthCheckService)(nil)
+
+func newHealthCheckService(services name2service, probeInterval, probeTimeout time.Duration) *healthCheckService {
+	if probeInterval <= 0 {
+		probeInterval = DefaultHealthProbeInterval
+	}
+	if probeTimeout <= 0 {
+		probeTimeout = DefaultHealthProbeTimeout
+	}
+	ret := &healthCheckService{
+		services:      make(name2service, len(services)),
+		probeInterval: probeInterval,
+		probeTimeout:  probeTimeout,
+		statuses:      make(map[string]health_check.ResponseStatus),
+		manual:        make(map[string]struct{}),
+		watchers:      make(map[string]map[chan health_check.ResponseStatus]struct{}),
+	}
+	ret.statuses[""] = health_check.StatusNotServing
+	for name, srv := range services {
+		ret.services[name] = srv
+		ret.statuses[name] = health_check.StatusNotServing
+	}
+	ret.statuses[ret.serviceName()] = health_check.StatusNotServing
+	return ret
+}
+
+func (hc *healthCheckService) serviceName() string {
+	return health_check.ServiceDesc.ServiceName
 }
 
 func (hc *healthCheckService) Description() grpc.ServiceDesc {
@@ -29,37 +90,268 @@ func (hc *healthCheckService) RegisterGRPC(_ context.Context, srv *grpc.Server)
 }
 
 func (hc *healthCheckService) OnStart() {
-	hc.ready.Store(true)
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	if hc.running++; hc.running > 1 {
+		return
+	}
+	for name := range hc.statuses {
+		if _, isManual := hc.manual[name]; !isManual && len(name) > 0 {
+			hc.setStatusLocked(name, health_check.StatusServing)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hc.stopProbes = cancel
+	go hc.runProbes(ctx)
 }
 
 func (hc *healthCheckService) OnStop() {
-	hc.ready.Store(false)
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	if hc.running == 0 {
+		return
+	}
+	if hc.running--; hc.running > 0 {
+		return
+	}
+	hc.markNotServingLocked()
+	hc.draining = false
 }
 
-func (hc *healthCheckService) HealthProbe(_ context.Context) (*health_check.Response, error) {
-	resp := &health_check.Response{Status: health_check.StatusNotServing}
-	switch imReady := hc.ready.Load().(type) {
-	case bool:
-		if imReady {
-			resp.Status = health_check.StatusServing
+//drain marks all services NOT_SERVING until the server stops
+func (hc *healthCheckService) drain() {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	hc.markNotServingLocked()
+	hc.draining = hc.running > 0
+}
+
+func (hc *healthCheckService) markNotServingLocked() {
+	if hc.stopProbes != nil {
+		hc.stopProbes()
+		hc.stopProbes = nil
+	}
+	for name := range hc.statuses {
+		if len(name) > 0 {
+			hc.setStatusLocked(name, health_check.StatusNotServing)
 		}
 	}
-	return resp, nil
 }
 
-func (hc *healthCheckService) Check(ctx context.Context, req *health_check.Request) (*health_check.Response, error) {
-	if ok, _ := hc.ready.Load().(bool); !ok {
-		return &health_check.Response{Status: health_check.StatusNotServing}, nil
+//SetServingStatus impl HealthRegistry
+func (hc *healthCheckService) SetServingStatus(service string, st health_check.ResponseStatus) {
+	if len(service) == 0 {
+		return
+	}
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	hc.manual[service] = struct{}{}
+	if hc.draining {
+		st = health_check.StatusNotServing
+	}
+	hc.setStatusLocked(service, st)
+}
+
+//ServingStatus impl HealthRegistry
+func (hc *healthCheckService) ServingStatus(service string) (health_check.ResponseStatus, bool) {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	st, ok := hc.statuses[service]
+	return st, ok
+}
+
+//ServingStatuses impl HealthRegistry
+func (hc *healthCheckService) ServingStatuses() map[string]health_check.ResponseStatus {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	ret := make(map[string]health_check.ResponseStatus, len(hc.statuses))
+	for k, v := range hc.statuses {
+		ret[k] = v
 	}
-	var resp *health_check.Response
-	var err error
+	return ret
+}
+
+func (hc *healthCheckService) HealthProbe(_ context.Context) (*health_check.Response, error) {
+	st, _ := hc.ServingStatus("")
+	return &health_check.Response{Status: st}, nil
+}
+
+func (hc *healthCheckService) Check(_ context.Context, req *health_check.Request) (*health_check.Response, error) {
+	st, ok := hc.ServingStatus(req.GetService())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service '%s'", req.GetService())
+	}
+	return &health_check.Response{Status: st}, nil
+}
+
+func (hc *healthCheckService) Watch(req *health_check.Request, stream health_check.WatchServer) error {
 	service := req.GetService()
-	if srv, ok := hc.services[service]; !ok {
-		resp = &health_check.Response{Status: health_check.StatusServiceUnknown}
-	} else if c, _ := srv.(HealthCheck); hc != nil {
-		resp, err = c.HealthProbe(ctx)
+	ch := make(chan health_check.ResponseStatus, 1)
+	hc.mx.Lock()
+	st, ok := hc.statuses[service]
+	if !ok {
+		st = health_check.StatusServiceUnknown
+	}
+	ch <- st
+	w := hc.watchers[service]
+	if w == nil {
+		w = make(map[chan health_check.ResponseStatus]struct{})
+		hc.watchers[service] = w
+	}
+	w[ch] = struct{}{}
+	hc.mx.Unlock()
+	defer func() {
+		hc.mx.Lock()
+		delete(hc.watchers[service], ch)
+		if len(hc.watchers[service]) == 0 {
+			delete(hc.watchers, service)
+		}
+		hc.mx.Unlock()
+	}()
+	var (
+		prev    health_check.ResponseStatus
+		hasPrev bool
+	)
+	for {
+		select {
+		case st = <-ch:
+			if hasPrev && prev == st {
+				continue
+			}
+			if err := stream.Send(&health_check.Response{Status: st}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+			prev, hasPrev = st, true
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+//addService registers service in health registry when it is added on the fly
+func (hc *healthCheckService) addService(name string, srv APIService) {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	hc.services[name] = srv
+	delete(hc.manual, name)
+	st := health_check.StatusNotServing
+	if hc.running > 0 && !hc.draining {
+		st = health_check.StatusServing
+	}
+	hc.setStatusLocked(name, st)
+}
+
+//enableService marks disabled service NOT_SERVING and keeps it so until it is enabled
+func (hc *healthCheckService) enableService(name string, enabled bool) {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	if _, ok := hc.services[name]; !ok {
+		return
+	}
+	st := health_check.StatusNotServing
+	if enabled {
+		delete(hc.manual, name)
+		if hc.running > 0 && !hc.draining {
+			st = health_check.StatusServing
+		}
 	} else {
-		resp, err = hc.HealthProbe(ctx)
+		hc.manual[name] = struct{}{}
+	}
+	hc.setStatusLocked(name, st)
+}
+
+//removeService unregisters service from health registry
+func (hc *healthCheckService) removeService(name string) {
+	hc.mx.Lock()
+	defer hc.mx.Unlock()
+	if _, ok := hc.statuses[name]; !ok || len(name) == 0 {
+		return
+	}
+	delete(hc.services, name)
+	delete(hc.statuses, name)
+	delete(hc.manual, name)
+	hc.notifyWatchersLocked(name, health_check.StatusServiceUnknown)
+	hc.recalcOverallLocked()
+}
+
+func (hc *healthCheckService) setStatusLocked(service string, st health_check.ResponseStatus) {
+	if old, ok := hc.statuses[service]; !ok || old != st {
+		hc.statuses[service] = st
+		hc.notifyWatchersLocked(service, st)
+	}
+	if len(service) > 0 {
+		hc.recalcOverallLocked()
+	}
+}
+
+func (hc *healthCheckService) recalcOverallLocked() {
+	overall := health_check.StatusServing
+	if hc.running == 0 {
+		overall = health_check.StatusNotServing
+	}
+	for name, s := range hc.statuses {
+		if len(name) > 0 && s != health_check.StatusServing {
+			overall = health_check.StatusNotServing
+			break
+		}
+	}
+	hc.setStatusLocked("", overall)
+}
+
+func (hc *healthCheckService) notifyWatchersLocked(service string, st health_check.ResponseStatus) {
+	for ch := range hc.watchers[service] {
+		select { //drop not consumed status
+		case <-ch:
+		default:
+		}
+		ch <- st
+	}
+}
+
+func (hc *healthCheckService) runProbes(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			hc.probeServices(ctx)
+			timer.Reset(hc.probeInterval)
+		}
+	}
+}
+
+func (hc *healthCheckService) probeServices(ctx context.Context) {
+	hc.mx.Lock()
+	services := make(name2service, len(hc.services))
+	for name, srv := range hc.services {
+		services[name] = srv
+	}
+	hc.mx.Unlock()
+	for name, srv := range services {
+		probe, _ := srv.(HealthCheck)
+		if probe == nil || name == hc.serviceName() {
+			continue
+		}
+		st := health_check.StatusNotServing
+		probeCtx, cancel := context.WithTimeout(ctx, hc.probeTimeout)
+		resp, err := probe.HealthProbe(probeCtx)
+		cancel()
+		if err == nil && resp != nil {
+			st = resp.GetStatus()
+		}
+		hc.mx.Lock()
+		//probes are stopped under lock so stopped probes can not override statuses are set on stop
+		stopped := ctx.Err() != nil
+		_, known := hc.services[name]
+		_, isManual := hc.manual[name]
+		if known && !isManual && !hc.draining && !stopped {
+			hc.setStatusLocked(name, st)
+		}
+		hc.mx.Unlock()
+		if stopped {
+			return
+		}
 	}
-	return resp, err
 }
@@ -3,8 +3,10 @@ package server
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
 	"github.com/thataway/common-lib/server/interceptors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/stats"
@@ -92,6 +94,24 @@ func WithRecovery(recovery *interceptors.Recovery) APIServerOption {
 	})
 }
 
+//WithConcurrencyLimiter sets load shedding limiter instead of default one that only counts in-flight calls
+func WithConcurrencyLimiter(limiter *interceptors.ConcurrencyLimiter) APIServerOption {
+	return serverOptApplier(func(srv *APIServer) error {
+		srv.addDefInterceptors &= ^interceptors.DefConcurrencyLimit
+		srv.concurrencyLimiter = limiter
+		return nil
+	})
+}
+
+//WithAPILogger sets API logger instead of default interceptors.LogServerAPI
+func WithAPILogger(l *interceptors.APILogger) APIServerOption {
+	return serverOptApplier(func(srv *APIServer) error {
+		srv.addDefInterceptors &= ^interceptors.DefLogServerAPI
+		srv.apiLogger = l
+		return nil
+	})
+}
+
 //SkipDefInterceptors ...
 func SkipDefInterceptors(ids ...interceptors.DefInterceptor) APIServerOption {
 	return serverOptApplier(func(srv *APIServer) error {
@@ -110,6 +130,36 @@ func WithTracer(t GRPCTracer) APIServerOption {
 	})
 }
 
+//WithHealthProbes sets interval and timeout to aggregate services HealthCheck.HealthProbe-s
+func WithHealthProbes(interval, timeout time.Duration) APIServerOption {
+	return serverOptApplier(func(srv *APIServer) error {
+		srv.healthProbeInterval = interval
+		srv.healthProbeTimeout = timeout
+		return nil
+	})
+}
+
+//WithHTTPHealthEndpoints mounts HTTP liveness and readiness endpoints; empty paths mean the default ones
+func WithHTTPHealthEndpoints(livenessPath, readinessPath string) APIServerOption {
+	return serverOptApplier(func(srv *APIServer) error {
+		if livenessPath = strings.TrimSpace(livenessPath); len(livenessPath) == 0 {
+			livenessPath = DefaultLivenessPath
+		}
+		if readinessPath = strings.TrimSpace(readinessPath); len(readinessPath) == 0 {
+			readinessPath = DefaultReadinessPath
+		}
+		if livenessPath == readinessPath {
+			return errors.Errorf("liveness and readiness endpoints have the same path '%s'", livenessPath)
+		}
+		srv.httpHealth = httpHealthProbes{
+			enabled:       true,
+			livenessPath:  livenessPath,
+			readinessPath: readinessPath,
+		}
+		return nil
+	})
+}
+
 //WithHttpHandler add HTTP handler for pattern
 func WithHttpHandler(pattern string, handler http.Handler) APIServerOption { //nolint:revive
 	return serverOptApplier(func(srv *APIServer) error {
@@ -134,6 +184,8 @@ var (
 	_ = WithHttpHandler
 	_ = WithDocs
 	_ = WithRecovery
+	_ = WithConcurrencyLimiter
+	_ = WithAPILogger
 	_ = WithServices
 	_ = WithGrpcServerOptions
 	_ = WithGatewayOptions
@@ -143,4 +195,6 @@ var (
 	_ = SkipDefInterceptors
 	_ = WithTapInHandlers
 	_ = WithTracer
+	_ = WithHealthProbes
+	_ = WithHTTPHealthEndpoints
 )
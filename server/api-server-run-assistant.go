@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -25,7 +26,10 @@ import (
 	"github.com/thataway/common-lib/server/interceptors"
 	"github.com/thataway/common-lib/server/internal"
 	"github.com/thataway/common-lib/server/swagger_ui"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	grpcReflection "google.golang.org/grpc/reflection"
 )
@@ -39,6 +43,7 @@ type runAPIServersAssistant struct {
 	grpcServers   map[uintptr]*grpc.Server
 	httpServers   map[uintptr]*http.Server
 	services      map[uintptr]name2service
+	dynamic       map[uintptr]*dynamicServices
 
 	onceInit    sync.Once
 	onceCleanup sync.Once
@@ -48,6 +53,8 @@ var (
 	nextRunID = uintptr(0)
 )
 
+type tlsConnCtxKey struct{}
+
 func (ass *runAPIServersAssistant) init() {
 	ass.onceInit.Do(func() {
 		ass.eventFailure = events.NewEvent(0)
@@ -59,6 +66,7 @@ func (ass *runAPIServersAssistant) init() {
 			&ass.grpcListeners,
 			&ass.grpcServers,
 			&ass.services,
+			&ass.dynamic,
 		}
 		for _, v := range in {
 			t := reflect.TypeOf(v).Elem()
@@ -70,6 +78,9 @@ func (ass *runAPIServersAssistant) init() {
 func (ass *runAPIServersAssistant) cleanup() {
 	ass.onceInit.Do(func() {})
 	ass.onceCleanup.Do(func() {
+		for id, d := range ass.dynamic {
+			d.detach(id)
+		}
 		for _, closer := range ass.multiplexers {
 			closer.Close()
 		}
@@ -79,7 +90,7 @@ func (ass *runAPIServersAssistant) cleanup() {
 	})
 }
 
-func (ass *runAPIServersAssistant) constructProxyConn(ctx context.Context, ep *pkgNet.Endpoint) (*grpc.ClientConn, error) {
+func (ass *runAPIServersAssistant) constructProxyConn(ctx context.Context, ep *pkgNet.Endpoint, tlsOpts *tlsOptions) (*grpc.ClientConn, error) {
 	opts := []grpc_retry.CallOption{
 		grpc_retry.WithBackoff(grpc_retry.BackoffExponential(100 * time.Millisecond)),
 		grpc_retry.WithMax(100),
@@ -90,10 +101,14 @@ func (ass *runAPIServersAssistant) constructProxyConn(ctx context.Context, ep *p
 	} else {
 		endpointAddr = ep.String()
 	}
+	transportCreds := grpc.WithInsecure()
+	if tlsOpts != nil {
+		transportCreds = grpc.WithTransportCredentials(credentials.NewTLS(tlsOpts.gatewayProxyConfig()))
+	}
 	ret, err := grpc.DialContext(
 		ctx,
 		endpointAddr,
-		grpc.WithInsecure(),
+		transportCreds,
 		grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor(opts...)),
 	)
 	if err == nil {
@@ -107,7 +122,8 @@ func (ass *runAPIServersAssistant) constructProxyConn(ctx context.Context, ep *p
 
 func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error {
 	for _, item := range runner.apiServers {
-		server, endpoint, hasGrpcAPI := item.serv, item.endpoint, len(item.serv.apis) > 0
+		server, endpoint := item.serv, item.endpoint
+		hasGrpcAPI := len(server.apis) > 0 || server.dynamic != nil
 
 		var (
 			gwOpts  []runtime.ServeMuxOption
@@ -117,11 +133,22 @@ func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error
 			gwProxy *grpc.ClientConn
 		)
 		if hasGrpcAPI {
+			streamInterceptors := server.grpcStreamInterceptors
+			if server.dynamic != nil {
+				streamInterceptors = append([]grpc.StreamServerInterceptor{server.dynamic.streamInterceptor},
+					streamInterceptors...)
+			}
 			grpcOpts := append([]grpc.ServerOption{},
 				grpc.ChainUnaryInterceptor(server.grpcUnaryInterceptors...),
-				grpc.ChainStreamInterceptor(server.grpcStreamInterceptors...),
+				grpc.ChainStreamInterceptor(streamInterceptors...),
 			)
+			if runner.tls != nil {
+				grpcOpts = append(grpcOpts, grpc.Creds(internal.NewTerminatedTLSCreds()))
+			}
 			grpcOpts = append(grpcOpts, server.grpcOptions...)
+			if server.dynamic != nil {
+				grpcOpts = append(grpcOpts, grpc.UnknownServiceHandler(server.dynamic.handleStream))
+			}
 			if len(server.grpcStatsHandlers) > 0 {
 				opt := grpc.StatsHandler(interceptors.Chain2StatsHandler(server.grpcStatsHandlers...))
 				grpcOpts = append(grpcOpts, opt)
@@ -142,6 +169,20 @@ func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error
 						md.Set(k, values...)
 					}
 				}
+				if pattern, ok := runtime.HTTPPathPattern(ctx); ok { //route template for HTTP metrics
+					internal.SetHTTPRoute(request.Context(), pattern)
+				}
+				markGatewayRouted(request.Context())
+				md.Delete(conventions.PeerIdentityHeader)
+				if runner.tls != nil { //forward identity of client certificate
+					var identity string
+					if tc, _ := request.Context().Value(tlsConnCtxKey{}).(*tls.Conn); tc != nil {
+						if st := tc.ConnectionState(); len(st.VerifiedChains) > 0 {
+							identity = interceptors.PeerCertIdentity(st.VerifiedChains[0][0])
+						}
+					}
+					md.Set(conventions.PeerIdentityHeader, identity)
+				}
 				return md
 			}))
 			gwOpts = append(gwOpts, server.gatewayOptions...)
@@ -157,7 +198,7 @@ func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error
 					gw = runtime.NewServeMux(gwOpts...)
 				}
 				if gwProxy == nil {
-					if gwProxy, err = ass.constructProxyConn(runner.ctx, endpoint); err != nil {
+					if gwProxy, err = ass.constructProxyConn(runner.ctx, endpoint, runner.tls); err != nil {
 						return errors.Wrapf(err, "unable create proxy gateway conn for endpoint '%s'", endpoint)
 					}
 					ass.gwProxies[i] = gwProxy
@@ -169,12 +210,38 @@ func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error
 			}
 		}
 		nw, addr := endpoint.Network(), endpoint.String()
-		if gw != nil || len(server.httpHandlers) > 0 {
+		if server.dynamic != nil {
+			if gwProxy == nil {
+				if gwProxy, err = ass.constructProxyConn(runner.ctx, endpoint, runner.tls); err != nil {
+					return errors.Wrapf(err, "unable create proxy gateway conn for endpoint '%s'", endpoint)
+				}
+				ass.gwProxies[i] = gwProxy
+			}
+			b := &dynamicBinding{ctx: runner.ctx, gwOptions: gwOpts, gwProxy: gwProxy}
+			if err = server.dynamic.attach(i, b); err != nil {
+				return errors.Wrapf(err, "unable attach dynamic services to endpoint '%s'", endpoint)
+			}
+			ass.dynamic[i] = server.dynamic
+		}
+		hasHTTP := gw != nil || len(server.httpHandlers) > 0 || server.dynamic != nil
+		if hasHTTP {
 			chiMux := chi.NewMux()
+			chiMux.Use(server.httpMiddlewares...)
 			for pattern, handler := range server.httpHandlers {
 				chiMux.Mount(pattern, http.StripPrefix(pattern, handler))
 			}
-			if gw != nil {
+			if server.dynamic != nil {
+				var static http.Handler
+				if gw != nil {
+					static = gw
+				}
+				chiMux.Mount("/", &dynamicGateway{static: static, dynamic: server.dynamic, runID: i})
+				chiMux.Mount("/docs", http.StripPrefix("/docs", &dynamicDocs{
+					dynamic: server.dynamic,
+					base:    server.docs,
+					host:    addr,
+				}))
+			} else if gw != nil {
 				chiMux.Mount("/", gw)
 				if server.docs != nil { //mount swagger documents
 					server.docs.Host = addr
@@ -187,28 +254,52 @@ func (ass *runAPIServersAssistant) construct(runner *runAPIServersOptions) error
 					chiMux.Mount("/docs", http.StripPrefix("/docs", swaggerHandler))
 				}
 			}
-			ass.httpServers[i] = &http.Server{
-				Handler: chiMux,
+			h2s := new(http2.Server)
+			httpSrv := &http.Server{
+				Handler: h2c.NewHandler(chiMux, h2s), //HTTP/2 clients are not GRPC ones come here
 				BaseContext: func(_ net.Listener) context.Context {
 					return runner.ctx
 				},
+				ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+					if tc, ok := internal.TLSConnOf(c); ok {
+						return context.WithValue(ctx, tlsConnCtxKey{}, tc)
+					}
+					return ctx
+				},
+			}
+			if err = http2.ConfigureServer(httpSrv, h2s); err != nil {
+				return errors.Wrap(err, "configure HTTP/2 server")
 			}
+			ass.httpServers[i] = httpSrv
 		}
 		var mx cmux.CMux
-		if mx, err = internal.NewCMux(endpoint); err != nil {
+		var tlsConf *tls.Config
+		if runner.tls != nil {
+			tlsConf = runner.tls.serverConfig()
+		}
+		if mx, err = internal.NewCMuxTLS(endpoint, tlsConf); err != nil {
 			return errors.Wrapf(err, "unable listen to '%s://%s'", nw, addr)
 		}
 		ass.multiplexers[i] = mx
-		if gw != nil || len(server.httpHandlers) > 0 {
-			ass.gwListeners[i] = mx.Match(cmux.HTTP1Fast())
-		}
 		if hasGrpcAPI {
 			ass.services[i] = server.apis
 			ass.grpcServers[i] = grpcS
-			ass.grpcListeners[i] = mx.Match(cmux.Any())
-			//mx.Match(cmux.HTTP2HeaderFieldPrefix("content-type", "application/grpc"))
+			if hasHTTP {
+				//GRPC clients wait for server SETTINGS before they send headers
+				ass.grpcListeners[i] = mx.MatchWithWriters(
+					cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc"))
+			} else {
+				ass.grpcListeners[i] = mx.Match(cmux.Any())
+			}
 			grpcReflection.Register(grpcS)
 		}
+		if hasHTTP {
+			gwListener := mx.Match(cmux.Any())
+			if hasGrpcAPI {
+				gwListener = internal.NewSettingsAckFilterListener(gwListener)
+			}
+			ass.gwListeners[i] = gwListener
+		}
 	}
 	return nil
 }
@@ -266,6 +357,9 @@ func (ass *runAPIServersAssistant) makeMultiplexersRunners(ctx context.Context)
 }
 
 func (ass *runAPIServersAssistant) notifyServerStart(id uintptr) {
+	if d := ass.dynamic[id]; d != nil {
+		d.notifyRunning(id, true)
+	}
 	for _, s := range ass.services[id] {
 		if f, _ := s.(APIServiceOnStartEvent); f != nil {
 			f.OnStart()
@@ -274,6 +368,9 @@ func (ass *runAPIServersAssistant) notifyServerStart(id uintptr) {
 }
 
 func (ass *runAPIServersAssistant) notifyServerStop(id uintptr) {
+	if d := ass.dynamic[id]; d != nil {
+		d.notifyRunning(id, false)
+	}
 	for _, s := range ass.services[id] {
 		if f, _ := s.(APIServiceOnStopEvent); f != nil {
 			f.OnStop()
@@ -353,6 +450,54 @@ func (ass *runAPIServersAssistant) makeGwRunners(ctx context.Context, gracefulSt
 	return runners
 }
 
+func (ass *runAPIServersAssistant) makeWatchersRunners(ctx context.Context, watchers []func(context.Context) error) []func() error {
+	var runners []func() error
+	eventFailure := ass.eventFailure
+	for _, w := range watchers {
+		w := w
+		runners = append(runners, func() error {
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				select {
+				case <-eventFailure.Done():
+					cancel()
+				case <-watchCtx.Done():
+				}
+			}()
+			return w(watchCtx)
+		})
+	}
+	return runners
+}
+
+func (ass *runAPIServersAssistant) makeDrainRunner(ctx context.Context, d *drainOptions, health []*healthCheckService, stopServe func()) func() error {
+	eventFailure := ass.eventFailure
+	return func() error {
+		defer stopServe()
+		select {
+		case <-ctx.Done():
+		case <-eventFailure.Done():
+			return nil
+		}
+		for _, h := range health {
+			h.drain()
+		}
+		d.notify(DrainNotServing)
+		if d.propagationDelay > 0 {
+			d.notify(DrainPropagation)
+			timer := time.NewTimer(d.propagationDelay)
+			select {
+			case <-timer.C:
+			case <-eventFailure.Done():
+				timer.Stop()
+			}
+		}
+		d.notify(DrainStopping)
+		return nil
+	}
+}
+
 func (ass *runAPIServersAssistant) serviceRIP(_ context.Context, s interface{}, gracefulStopPeriod time.Duration) {
 	var (
 		stop         func()
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+)
+
+type (
+	//DrainPhase phase of drain sequence before servers stop
+	DrainPhase int
+
+	//OnDrainEvent it is sent on every drain phase
+	OnDrainEvent struct {
+		observer.EventType
+		Phase DrainPhase
+		At    time.Time
+	}
+
+	//OnDrainEventObserver ...
+	OnDrainEventObserver func(OnDrainEvent)
+)
+
+const (
+	//DrainNotServing all services are marked NOT_SERVING in health service
+	DrainNotServing DrainPhase = iota
+	//DrainPropagation servers wait for propagation delay and still accept requests
+	DrainPropagation
+	//DrainStopping servers are stopping gracefully
+	DrainStopping
+	//DrainDone servers are stopped
+	DrainDone
+)
+
+func (p DrainPhase) String() string {
+	switch p {
+	case DrainNotServing:
+		return "not-serving"
+	case DrainPropagation:
+		return "propagation"
+	case DrainStopping:
+		return "stopping"
+	case DrainDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+//RunWithDrain turns on drain sequence on shutdown: at first all services are marked NOT_SERVING,
+//then servers still accept requests during 'propagationDelay', then servers stop gracefully
+func RunWithDrain(propagationDelay time.Duration, observers ...OnDrainEventObserver) RunAPIServersOption {
+	return runAPIServersOptionsApplier(func(o *runAPIServersOptions) error {
+		d := &drainOptions{propagationDelay: propagationDelay}
+		if len(observers) > 0 {
+			d.subject = observer.NewSubject()
+			var evt OnDrainEvent
+			seen := make(map[reflect.Value]bool)
+			for _, obs := range observers {
+				if v := reflect.ValueOf(obs); !seen[v] {
+					seen[v] = true
+				} else {
+					continue
+				}
+				obs := obs
+				d.subject.ObserversAttach(observer.NewObserver(func(event observer.EventType) {
+					if ev, ok := event.(OnDrainEvent); ok {
+						obs(ev)
+					}
+				}, false, evt))
+			}
+		}
+		o.drain = d
+		return nil
+	})
+}
+
+var (
+	_ = RunWithDrain
+)
+
+type drainOptions struct {
+	propagationDelay time.Duration
+	subject          observer.Subject
+}
+
+func (d *drainOptions) notify(phase DrainPhase) {
+	if d.subject != nil {
+		d.subject.Notify(OnDrainEvent{Phase: phase, At: time.Now()})
+	}
+}
@@ -43,6 +43,8 @@ var (
 type runAPIServersOptions struct {
 	ctx                context.Context
 	gracefulStopPeriod time.Duration
+	tls                *tlsOptions
+	drain              *drainOptions
 	apiServers         []struct {
 		endpoint *pkgNet.Endpoint // "TCP" | "UNIX" address => tcp://192.168.1.1:500 | unix://path-to-socket
 		serv     *APIServer
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	//GetCertificateFunc gives actual server certificate; it is used as a reload hook for rotated certs
+	GetCertificateFunc = func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	//TLSOption TLS option to RunWithTLS
+	TLSOption interface {
+		apply(*tlsOptions) error
+	}
+)
+
+//RunWithTLS serves all multiplexed GRPC, grpc-gateway and swagger traffic over TLS
+func RunWithTLS(options ...TLSOption) RunAPIServersOption {
+	return runAPIServersOptionsApplier(func(o *runAPIServersOptions) error {
+		const api = "RunWithTLS"
+		opts := new(tlsOptions)
+		for _, opt := range options {
+			if err := opt.apply(opts); err != nil {
+				return errors.Wrap(err, api)
+			}
+		}
+		if len(opts.certificates) == 0 && opts.getCertificate == nil {
+			return errors.Errorf("%s: no any server certificate is provided", api)
+		}
+		if opts.clientCAs != nil && opts.gatewayClientCert == nil {
+			return errors.Errorf("%s: mutual TLS requires gateway client certificate", api)
+		}
+		o.tls = opts
+		return nil
+	})
+}
+
+//TLSWithCertificates adds server certificates
+func TLSWithCertificates(certs ...tls.Certificate) TLSOption {
+	return tlsOptionApplier(func(o *tlsOptions) error {
+		for i := range certs {
+			if len(certs[i].Certificate) == 0 {
+				return errors.New("empty server certificate")
+			}
+		}
+		o.certificates = append(o.certificates, certs...)
+		return nil
+	})
+}
+
+//TLSWithClientCAs turns on mutual TLS - client certificates are required and verified by these CAs;
+//TLSWithGatewayClientCert is required as well
+func TLSWithClientCAs(pool *x509.CertPool) TLSOption {
+	return tlsOptionApplier(func(o *tlsOptions) error {
+		o.clientCAs = pool
+		return nil
+	})
+}
+
+//TLSWithCertReloader sets reload hook for rotated server certificates
+func TLSWithCertReloader(f GetCertificateFunc) TLSOption {
+	return tlsOptionApplier(func(o *tlsOptions) error {
+		o.getCertificate = f
+		return nil
+	})
+}
+
+//TLSWithCertProvider sets reloadable source of server certificates; it watches for changes while servers run
+func TLSWithCertProvider(p CertProvider) TLSOption {
+	return tlsOptionApplier(func(o *tlsOptions) error {
+		if p == nil {
+			return errors.New("no cert provider is provided")
+		}
+		o.getCertificate = p.GetCertificate
+		o.watchers = append(o.watchers, p.Watch)
+		return nil
+	})
+}
+
+//TLSWithGatewayClientCert sets client certificate to internal gateway-to-GRPC proxy conn;
+//it is required when mutual TLS is on
+func TLSWithGatewayClientCert(cert tls.Certificate) TLSOption {
+	return tlsOptionApplier(func(o *tlsOptions) error {
+		if len(cert.Certificate) == 0 {
+			return errors.New("empty gateway client certificate")
+		}
+		o.gatewayClientCert = &cert
+		return nil
+	})
+}
+
+var (
+	_ = RunWithTLS
+	_ = TLSWithCertificates
+	_ = TLSWithClientCAs
+	_ = TLSWithCertReloader
+	_ = TLSWithCertProvider
+	_ = TLSWithGatewayClientCert
+)
+
+type (
+	tlsOptions struct {
+		certificates      []tls.Certificate
+		clientCAs         *x509.CertPool
+		getCertificate    GetCertificateFunc
+		gatewayClientCert *tls.Certificate
+		watchers          []func(context.Context) error
+	}
+
+	tlsOptionApplier func(o *tlsOptions) error
+)
+
+func (f tlsOptionApplier) apply(o *tlsOptions) error {
+	return f(o)
+}
+
+func (o *tlsOptions) currentCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if o.getCertificate != nil {
+		if c, e := o.getCertificate(hello); e != nil || c != nil {
+			return c, e
+		}
+	}
+	if len(o.certificates) > 0 {
+		return &o.certificates[0], nil
+	}
+	return nil, errors.New("no any server certificate is available")
+}
+
+func (o *tlsOptions) serverConfig() *tls.Config {
+	ret := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: o.certificates,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if o.getCertificate != nil {
+		ret.GetCertificate = o.currentCertificate
+	}
+	if o.clientCAs != nil {
+		ret.ClientCAs = o.clientCAs
+		ret.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return ret
+}
+
+//gatewayProxyConfig the proxy conn dials to our own endpoint so it pins current server certificate
+func (o *tlsOptions) gatewayProxyConfig() *tls.Config {
+	ret := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, //nolint:gosec
+		NextProtos:         []string{"h2"},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("gateway proxy: server has no certificate")
+			}
+			candidates := make([]*tls.Certificate, 0, len(o.certificates)+1)
+			if o.getCertificate != nil {
+				if c, _ := o.getCertificate(&tls.ClientHelloInfo{}); c != nil {
+					candidates = append(candidates, c)
+				}
+			}
+			for i := range o.certificates {
+				candidates = append(candidates, &o.certificates[i])
+			}
+			for _, c := range candidates {
+				if len(c.Certificate) > 0 && bytes.Equal(c.Certificate[0], rawCerts[0]) {
+					return nil
+				}
+			}
+			return errors.New("gateway proxy: unexpected server certificate")
+		},
+	}
+	if o.clientCAs != nil {
+		ret.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if c := o.gatewayClientCert; c != nil {
+				return c, nil
+			}
+			return nil, errors.New("gateway proxy: no client certificate")
+		}
+	}
+	return ret
+}
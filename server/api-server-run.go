@@ -5,6 +5,7 @@ import (
 	"github.com/pkg/errors"
 	pkgNet "github.com/thataway/common-lib/pkg/net"
 	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server/internal"
 )
 
 //RunAPIServersOption option interface to call RunAPIServers
@@ -29,15 +30,33 @@ func (srv *APIServer) Run(ctx context.Context, endpoint *pkgNet.Endpoint, option
 	var ass runAPIServersAssistant
 	ass.init()
 	defer ass.cleanup()
+	var runners []func() error
+	if d := runnerOptions.drain; d != nil {
+		serveCtx, stopServe := context.WithCancel(internal.DetachedContext(ctx))
+		defer func() {
+			stopServe()
+			d.notify(DrainDone)
+		}()
+		var health []*healthCheckService
+		for _, s := range runnerOptions.apiServers {
+			if h := s.serv.health; h != nil {
+				health = append(health, h)
+			}
+		}
+		runners = append(runners, ass.makeDrainRunner(ctx, d, health, stopServe))
+		runnerOptions.ctx, ctx = serveCtx, serveCtx
+	}
 	if err = ass.construct(runnerOptions); err != nil {
 		return errors.Wrap(err, api)
 	}
 
-	var runners []func() error
 	runners = append(runners, ass.makeWait2CloseRunner(ctx))
 	runners = append(runners, ass.makeMultiplexersRunners(ctx)...)
 	runners = append(runners, ass.makeGrpcRunners(ctx, runnerOptions.gracefulStopPeriod)...)
 	runners = append(runners, ass.makeGwRunners(ctx, runnerOptions.gracefulStopPeriod)...)
+	if t := runnerOptions.tls; t != nil {
+		runners = append(runners, ass.makeWatchersRunners(ctx, t.watchers)...)
+	}
 	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
 		return runners[i]()
 	})
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+)
+
+type (
+	//CertProvider source of server certificates which can watch for their changes
+	CertProvider interface {
+		GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+		Watch(ctx context.Context) error
+	}
+
+	//FileCertProvider reloads cert-key pair from files when they are changed on disk
+	FileCertProvider struct {
+		certFile      string
+		keyFile       string
+		checkInterval time.Duration
+		subject       observer.Subject
+		current       atomic.Value
+		mx            sync.Mutex
+		stamp         certFilesStamp
+	}
+
+	//FileCertProviderOption option to FileCertProvider
+	FileCertProviderOption func(*FileCertProvider)
+
+	//OnCertReloaded FileCertProvider event when certificate is reloaded
+	OnCertReloaded struct {
+		observer.EventType
+		CertFile string
+		KeyFile  string
+		NotAfter time.Time
+	}
+
+	//OnCertReloadFailed FileCertProvider event when certificate has failed to reload
+	OnCertReloadFailed struct {
+		observer.EventType
+		CertFile string
+		KeyFile  string
+		Reason   error
+	}
+
+	certFilesStamp [2]struct {
+		modTime time.Time
+		size    int64
+	}
+)
+
+//DefaultCertCheckInterval default interval to check cert files for changes
+const DefaultCertCheckInterval = 10 * time.Second
+
+//FileCertWithCheckInterval sets interval to check cert files for changes
+func FileCertWithCheckInterval(d time.Duration) FileCertProviderOption {
+	return func(p *FileCertProvider) {
+		if d > 0 {
+			p.checkInterval = d
+		}
+	}
+}
+
+//NewFileCertProvider makes cert provider from PEM encoded cert and key files
+func NewFileCertProvider(certFile, keyFile string, opts ...FileCertProviderOption) (*FileCertProvider, error) {
+	const api = "NewFileCertProvider"
+	ret := &FileCertProvider{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: DefaultCertCheckInterval,
+		subject:       observer.NewSubject(),
+	}
+	for _, o := range opts {
+		o(ret)
+	}
+	if _, err := ret.reload(true); err != nil {
+		return nil, errors.Wrap(err, api)
+	}
+	return ret, nil
+}
+
+var (
+	_ CertProvider = (*FileCertProvider)(nil)
+	_              = NewFileCertProvider
+	_              = FileCertWithCheckInterval
+)
+
+//Subject it publishes OnCertReloaded and OnCertReloadFailed events
+func (p *FileCertProvider) Subject() observer.Subject {
+	return p.subject
+}
+
+//GetCertificate gives current certificate
+func (p *FileCertProvider) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c, _ := p.current.Load().(*tls.Certificate)
+	if c == nil {
+		return nil, errors.Errorf("no certificate is loaded from '%s'", p.certFile)
+	}
+	return c, nil
+}
+
+//Reload forces to reload cert-key pair
+func (p *FileCertProvider) Reload() error {
+	_, err := p.reload(true)
+	return err
+}
+
+//Watch checks cert files for changes until context is done
+func (p *FileCertProvider) Watch(ctx context.Context) error {
+	ticker := time.NewTicker(p.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, _ = p.reload(false)
+		}
+	}
+}
+
+func (p *FileCertProvider) reload(force bool) (bool, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	stamp, err := p.filesStamp()
+	if err == nil && !force && stamp == p.stamp {
+		return false, nil
+	}
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	}
+	if err == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "unable load cert '%s' and key '%s'", p.certFile, p.keyFile)
+		p.subject.Notify(OnCertReloadFailed{
+			CertFile: p.certFile,
+			KeyFile:  p.keyFile,
+			Reason:   err,
+		})
+		return false, err
+	}
+	p.stamp = stamp
+	p.current.Store(&cert)
+	p.subject.Notify(OnCertReloaded{
+		CertFile: p.certFile,
+		KeyFile:  p.keyFile,
+		NotAfter: cert.Leaf.NotAfter,
+	})
+	return true, nil
+}
+
+func (p *FileCertProvider) filesStamp() (ret certFilesStamp, err error) {
+	for i, f := range []string{p.certFile, p.keyFile} {
+		var st os.FileInfo
+		if st, err = os.Stat(f); err != nil {
+			return ret, err
+		}
+		ret[i].modTime, ret[i].size = st.ModTime(), st.Size()
+	}
+	return ret, nil
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/pkg/errors"
@@ -25,9 +26,17 @@ type (
 		grpcTapHandlers        []tap.ServerInHandle
 		apis                   name2service
 		httpHandlers           httpHandlers
+		httpMiddlewares        []func(http.Handler) http.Handler
 		addDefInterceptors     interceptors.DefInterceptor
 		recovery               *interceptors.Recovery
+		concurrencyLimiter     *interceptors.ConcurrencyLimiter
+		apiLogger              *interceptors.APILogger
 		grpcTracer             GRPCTracer
+		health                 *healthCheckService
+		healthProbeInterval    time.Duration
+		healthProbeTimeout     time.Duration
+		httpHealth             httpHealthProbes
+		dynamic                *dynamicServices
 	}
 
 	//GRPCTracer tracer
@@ -36,6 +45,12 @@ type (
 		TraceStreamCalls(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error
 	}
 
+	//HTTPMiddlewareProvider stats handler which gives HTTP middleware too, e.g. one of metrics;
+	//its middleware is added to HTTP handlers of server
+	HTTPMiddlewareProvider interface {
+		HTTPMiddleware(next http.Handler) http.Handler
+	}
+
 	//APIServerOption опции для APIServer
 	APIServerOption interface {
 		apply(*APIServer) error
@@ -57,13 +72,24 @@ func NewAPIServer(options ...APIServerOption) (*APIServer, error) {
 			return nil, errors.Wrapf(err, "%s: applying otions", api)
 		}
 	}
-	if len(ret.apis) == 0 {
-		return &APIServer{httpHandlers: ret.httpHandlers, apis: ret.apis}, nil
+	if h := ret.httpHealth; h.enabled {
+		readiness := readinessHandler{registry: ret.HealthRegistry}
+		for pattern, handler := range map[string]http.Handler{h.livenessPath: livenessHandler{}, h.readinessPath: readiness} {
+			if err := WithHttpHandler(pattern, handler).apply(ret); err != nil {
+				return nil, errors.Wrap(err, api)
+			}
+		}
+	}
+	for _, h := range ret.grpcStatsHandlers {
+		if p, _ := h.(HTTPMiddlewareProvider); p != nil {
+			ret.httpMiddlewares = append(ret.httpMiddlewares, p.HTTPMiddleware)
+		}
+	}
+	if len(ret.apis) == 0 && ret.dynamic == nil {
+		return &APIServer{httpHandlers: ret.httpHandlers, httpMiddlewares: ret.httpMiddlewares, apis: ret.apis}, nil
 	}
-	err := ret.addService(&healthCheckService{
-		services: ret.apis,
-	})
-	if err != nil {
+	ret.health = newHealthCheckService(ret.apis, ret.healthProbeInterval, ret.healthProbeTimeout)
+	if err := ret.addService(ret.health); err != nil {
 		return nil, errors.Wrap(err, api)
 	}
 
@@ -74,11 +100,13 @@ func NewAPIServer(options ...APIServerOption) (*APIServer, error) {
 		defStream = append(defStream, t.TraceStreamCalls)
 	}
 
-	var logMethods bool
+	logMethods := ret.apiLogger
 	for i := interceptors.DefInterceptor(1); i&interceptors.DefAll == i; i <<= 1 {
 		switch i {
 		case interceptors.DefLogServerAPI:
-			logMethods = i&ret.addDefInterceptors != 0
+			if i&ret.addDefInterceptors != 0 {
+				logMethods = interceptors.LogServerAPI
+			}
 		case interceptors.DefRecovery:
 			r := ret.recovery
 			if i&ret.addDefInterceptors != 0 {
@@ -88,6 +116,15 @@ func NewAPIServer(options ...APIServerOption) (*APIServer, error) {
 				defStream = append(defStream, r.Stream)
 				defUnary = append(defUnary, r.Unary)
 			}
+		case interceptors.DefConcurrencyLimit:
+			l := ret.concurrencyLimiter
+			if i&ret.addDefInterceptors != 0 {
+				l = interceptors.NewConcurrencyLimiter()
+			}
+			if l != nil {
+				defStream = append(defStream, l.Stream)
+				defUnary = append(defUnary, l.Unary)
+			}
 		case interceptors.DefLogLevelOverride:
 			if i&ret.addDefInterceptors != 0 {
 				r := interceptors.LogLevelOverrider
@@ -100,14 +137,25 @@ func NewAPIServer(options ...APIServerOption) (*APIServer, error) {
 	}
 	ret.grpcUnaryInterceptors = append(defUnary, ret.grpcUnaryInterceptors...)
 	ret.grpcStreamInterceptors = append(defStream, ret.grpcStreamInterceptors...)
-	if logMethods {
-		ret.grpcUnaryInterceptors = append(ret.grpcUnaryInterceptors, interceptors.LogServerAPI.Unary)
-		ret.grpcStreamInterceptors = append(ret.grpcStreamInterceptors, interceptors.LogServerAPI.Stream)
+	if logMethods != nil {
+		ret.grpcUnaryInterceptors = append(ret.grpcUnaryInterceptors, logMethods.Unary)
+		ret.grpcStreamInterceptors = append(ret.grpcStreamInterceptors, logMethods.Stream)
+	}
+	if ret.dynamic != nil {
+		ret.dynamic.unaryInterceptor = chainUnaryInterceptors(ret.grpcUnaryInterceptors)
 	}
 
 	return ret, nil
 }
 
+//HealthRegistry gives registry of services serving statuses; it is nil if server has no GRPC services
+func (srv *APIServer) HealthRegistry() HealthRegistry {
+	if srv.health == nil {
+		return nil
+	}
+	return srv.health
+}
+
 type (
 	name2service = map[string]APIService
 	httpHandlers = map[string]http.Handler
@@ -10,6 +10,8 @@ type (
 	Request        = hc.HealthCheckRequest                //nolint
 	Response       = hc.HealthCheckResponse               //nolint
 	Unimplemented  = hc.UnimplementedHealthServer         //nolint
+	WatchServer    = hc.Health_WatchServer                //nolint
+	Client         = hc.HealthClient                      //nolint
 )
 
 const (
@@ -23,8 +25,14 @@ func RegisterGRPC(s grpc.ServiceRegistrar, srv hc.HealthServer) { //nolint
 	s.RegisterService(&hc.Health_ServiceDesc, srv)
 }
 
+//NewClient makes health check client
+func NewClient(cc grpc.ClientConnInterface) Client { //nolint
+	return hc.NewHealthClient(cc)
+}
+
 var (
 	_           = RegisterGRPC
+	_           = NewClient
 	ServiceDesc = hc.Health_ServiceDesc //nolint
 	_           = StatusUnknown | StatusServing | StatusNotServing | StatusServiceUnknown
 )
@@ -0,0 +1,236 @@
+package interceptors
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/logger"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/pkg/jsonview"
+	"github.com/thataway/common-lib/server/internal"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//AuditOption ...
+type AuditOption func(*Auditor) error
+
+//AuditToWriter audit records go to writer; writer need not be goroutine safe
+func AuditToWriter(w io.Writer) AuditOption {
+	return func(a *Auditor) error {
+		a.sink = w
+		return nil
+	}
+}
+
+//AuditToFile audit records are appended to file
+func AuditToFile(fileName string) AuditOption {
+	return func(a *Auditor) error {
+		f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		a.sink, a.closer = f, f
+		return nil
+	}
+}
+
+//AuditToRotatedFile audit records are appended to file is rotated by size; look at logger.NewRotatedFile
+func AuditToRotatedFile(fileName string, maxSize int64, maxBackups int) AuditOption {
+	return func(a *Auditor) error {
+		f, err := logger.NewRotatedFile(fileName, maxSize, maxBackups)
+		if err != nil {
+			return err
+		}
+		a.sink, a.closer = f, f
+		return nil
+	}
+}
+
+//AuditRedactFields paths or full names of request and response fields to hide in addition to ones marked by options;
+//look at jsonview.Redactor
+func AuditRedactFields(paths ...string) AuditOption {
+	return func(a *Auditor) error {
+		a.redactFields = append(a.redactFields, paths...)
+		return nil
+	}
+}
+
+//AuditSamplePayloads fraction [0, 1] of unary calls which records have request and response bodies; 0 is default
+func AuditSamplePayloads(rate float64) AuditOption {
+	return func(a *Auditor) error {
+		if rate < 0 || rate > 1 {
+			return errors.Errorf("payload sample rate %v is out of [0, 1]", rate)
+		}
+		a.sampleRate = rate
+		return nil
+	}
+}
+
+//AuditSkipMethods methods are not audited; patterns are like in AuthForMethods
+func AuditSkipMethods(patterns ...string) AuditOption {
+	return func(a *Auditor) error {
+		for _, s := range patterns {
+			p, err := parseMethodPattern(s)
+			if err != nil {
+				return err
+			}
+			a.skip = append(a.skip, p)
+		}
+		return nil
+	}
+}
+
+//Auditor writes record of every call: who called which method, when, with what status and latency;
+//it should precede Authenticator in chain to audit rejected callers too
+type Auditor struct {
+	sink         io.Writer
+	closer       io.Closer
+	log          logger.TypeOfLogger
+	redactFields []string
+	redactor     *jsonview.Redactor
+	sampleRate   float64
+	skip         []methodPattern
+}
+
+//NewAuditor makes auditor; sink option is required
+func NewAuditor(opts ...AuditOption) (*Auditor, error) {
+	const api = "NewAuditor"
+	ret := new(Auditor)
+	for _, o := range opts {
+		if err := o(ret); err != nil {
+			if ret.closer != nil {
+				_ = ret.closer.Close()
+			}
+			return nil, errors.Wrap(err, api)
+		}
+	}
+	if ret.sink == nil {
+		return nil, errors.Errorf("%s: no sink", api)
+	}
+	//records of concurrent calls are written to sink one by one
+	ret.log = logger.NewWithSink(zap.InfoLevel, zapcore.Lock(zapcore.AddSync(ret.sink)))
+	ret.redactor = jsonview.NewRedactor(ret.redactFields...)
+	return ret, nil
+}
+
+//Close closes file sink
+func (a *Auditor) Close() error {
+	_ = a.log.Sync()
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+//Unary ...
+func (a *Auditor) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	mi, audited := a.audited(ctx, info.FullMethod)
+	if !audited {
+		return handler(ctx, req)
+	}
+	slot := new(auditSlot)
+	ctx = context.WithValue(ctx, auditSlotCtxKey{}, slot)
+	timePoint := time.Now()
+	resp, err := handler(ctx, req)
+	rec := a.makeRecord(ctx, mi, slot, time.Since(timePoint), err)
+	if a.sampleRate > 0 && rand.Float64() < a.sampleRate { //nolint:gosec
+		rec.Req = a.redactor.Marshaler(req)
+		if err == nil {
+			rec.Resp = a.redactor.Marshaler(resp)
+		}
+	}
+	a.log.Infow("Unary/AUDIT", "details", rec)
+	return resp, err
+}
+
+//Stream ...
+func (a *Auditor) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := ss.Context()
+	mi, audited := a.audited(ctx, info.FullMethod)
+	if !audited {
+		return handler(srv, ss)
+	}
+	slot := new(auditSlot)
+	ctx = context.WithValue(ctx, auditSlotCtxKey{}, slot)
+	timePoint := time.Now()
+	err := handler(srv, internal.ServerStreamWithContext(ctx, ss))
+	rec := a.makeRecord(ctx, mi, slot, time.Since(timePoint), err)
+	a.log.Infow("Stream/AUDIT", "details", rec)
+	return err
+}
+
+type (
+	auditSlotCtxKey struct{}
+
+	//auditSlot gets principal from Authenticator is next in chain
+	auditSlot struct {
+		principal *Principal
+	}
+
+	auditRecord struct {
+		Service       string      `json:"service"`
+		Method        string      `json:"method"`
+		Principal     string      `json:"principal,omitempty"`
+		PrincipalKind string      `json:"principal_kind,omitempty"`
+		ClientName    string      `json:"client_name,omitempty"`
+		Peer          string      `json:"peer,omitempty"`
+		Code          string      `json:"code"`
+		Duration      interface{} `json:"duration"`
+		Error         string      `json:"err,omitempty"`
+		Req           interface{} `json:"req,omitempty"`
+		Resp          interface{} `json:"resp,omitempty"`
+	}
+)
+
+func noteAuditPrincipal(ctx context.Context, p *Principal) {
+	if slot, _ := ctx.Value(auditSlotCtxKey{}).(*auditSlot); slot != nil {
+		slot.principal = p
+	}
+}
+
+func (a *Auditor) audited(ctx context.Context, method string) (conventions.GrpcMethodInfo, bool) {
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		if e := mi.Init(method); e != nil {
+			panic(e)
+		}
+	}
+	for _, p := range a.skip {
+		if _, ok := p.match(mi); ok {
+			return mi, false
+		}
+	}
+	return mi, true
+}
+
+func (a *Auditor) makeRecord(ctx context.Context, mi conventions.GrpcMethodInfo, slot *auditSlot, d time.Duration, err error) *auditRecord {
+	rec := &auditRecord{
+		Service:    mi.ServiceFQN,
+		Method:     mi.Method,
+		ClientName: conventions.ClientName.Incoming(ctx, ""),
+		Code:       status.Code(err).String(),
+		Duration:   jsonview.Marshaler(d),
+	}
+	p := slot.principal
+	if p == nil {
+		p, _ = PrincipalFromContext(ctx)
+	}
+	if p != nil {
+		rec.Principal, rec.PrincipalKind = p.Name, p.Kind
+	}
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		rec.Peer = pr.Addr.String()
+	}
+	if err != nil {
+		rec.Error = status.Convert(err).Message()
+	}
+	return rec
+}
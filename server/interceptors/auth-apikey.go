@@ -0,0 +1,51 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc/metadata"
+)
+
+//AuthKindAPIKey kind of APIKeyVerifier
+const AuthKindAPIKey = "api_key"
+
+//APIKeyVerifier verifies static API keys from conventions.APIKeyHeader
+type APIKeyVerifier struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+var _ AuthVerifier = (*APIKeyVerifier)(nil)
+
+//NewAPIKeyVerifier makes verifier of static API keys; keys are mapped to its owners
+func NewAPIKeyVerifier(keys map[string]Principal) *APIKeyVerifier {
+	ret := &APIKeyVerifier{
+		keys: make(map[[sha256.Size]byte]Principal, len(keys)),
+	}
+	for k, p := range keys {
+		ret.keys[sha256.Sum256([]byte(k))] = p
+	}
+	return ret
+}
+
+//Kind impl AuthVerifier
+func (v *APIKeyVerifier) Kind() string {
+	return AuthKindAPIKey
+}
+
+//Verify impl AuthVerifier
+func (v *APIKeyVerifier) Verify(_ context.Context, md metadata.MD) (*Principal, error) {
+	values := md.Get(conventions.APIKeyHeader)
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	p, ok := v.keys[sha256.Sum256([]byte(values[0]))]
+	if !ok {
+		return nil, errors.New("unknown API key")
+	}
+	p.Kind = AuthKindAPIKey
+	p.Roles = append([]string(nil), p.Roles...)
+	return &p, nil
+}
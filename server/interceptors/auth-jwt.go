@@ -0,0 +1,356 @@
+package interceptors
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" //hash functions for signatures
+	_ "crypto/sha512" //hash functions for signatures
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc/metadata"
+)
+
+//AuthKindJWT kind of JWTVerifier
+const AuthKindJWT = "jwt"
+
+//DefaultJWTRolesClaim default claim holds roles of principal
+const DefaultJWTRolesClaim = "roles"
+
+//JWTOption ...
+type JWTOption func(*JWTVerifier)
+
+//JWTWithIssuer token must be issued by 'iss'
+func JWTWithIssuer(iss string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.issuer = iss
+	}
+}
+
+//JWTWithAudience token must be issued for 'aud'
+func JWTWithAudience(aud string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.audience = aud
+	}
+}
+
+//JWTWithRolesClaim claim holds roles of principal; it is array of strings or space separated string
+func JWTWithRolesClaim(claim string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.rolesClaim = claim
+	}
+}
+
+//JWTWithLeeway clock skew is tolerated on check of 'exp' and 'nbf'
+func JWTWithLeeway(leeway time.Duration) JWTOption {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+//JWTVerifier verifies bearer JWT from conventions.AuthorizationHeader with keys from local JWKS file
+type JWTVerifier struct {
+	jwksFile   string
+	issuer     string
+	audience   string
+	rolesClaim string
+	leeway     time.Duration
+	keys       atomic.Value
+}
+
+var _ AuthVerifier = (*JWTVerifier)(nil)
+
+//NewJWTVerifier makes verifier loads keys from JWKS file
+func NewJWTVerifier(jwksFile string, opts ...JWTOption) (*JWTVerifier, error) {
+	const api = "NewJWTVerifier"
+	ret := &JWTVerifier{
+		jwksFile:   jwksFile,
+		rolesClaim: DefaultJWTRolesClaim,
+	}
+	for _, o := range opts {
+		o(ret)
+	}
+	if err := ret.Reload(); err != nil {
+		return nil, errors.Wrap(err, api)
+	}
+	return ret, nil
+}
+
+//Reload reloads keys from JWKS file
+func (v *JWTVerifier) Reload() error {
+	const api = "JWTVerifier.Reload"
+	data, err := ioutil.ReadFile(v.jwksFile)
+	if err != nil {
+		return errors.Wrap(err, api)
+	}
+	var keys []jwk
+	if keys, err = parseJWKS(data); err != nil {
+		return errors.Wrapf(err, "%s: from '%s'", api, v.jwksFile)
+	}
+	v.keys.Store(keys)
+	return nil
+}
+
+//Kind impl AuthVerifier
+func (v *JWTVerifier) Kind() string {
+	return AuthKindJWT
+}
+
+//Verify impl AuthVerifier
+func (v *JWTVerifier) Verify(_ context.Context, md metadata.MD) (*Principal, error) {
+	const bearer = "bearer "
+	values := md.Get(conventions.AuthorizationHeader)
+	if len(values) == 0 {
+		return nil, ErrNoCredentials
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) < len(bearer) || !strings.EqualFold(token[:len(bearer)], bearer) {
+		return nil, ErrNoCredentials
+	}
+	claims, err := v.verifyToken(strings.TrimSpace(token[len(bearer):]), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ret := &Principal{
+		Kind:   AuthKindJWT,
+		Claims: claims,
+	}
+	ret.Name, _ = claims["sub"].(string)
+	switch roles := claims[v.rolesClaim].(type) {
+	case string:
+		ret.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				ret.Roles = append(ret.Roles, s)
+			}
+		}
+	}
+	return ret, nil
+}
+
+type (
+	jwk struct {
+		kid string
+		alg string
+		key crypto.PublicKey
+	}
+
+	jwkJSON struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	jwtHeader struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+)
+
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	var ret []jwk
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "key '%s'", k.Kid)
+		}
+		ret = append(ret, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no signature keys")
+	}
+	return ret, nil
+}
+
+func (k jwkJSON) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		var e []byte
+		if e, err = b64.DecodeString(k.E); err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		var y []byte
+		if y, err = b64.DecodeString(k.Y); err != nil {
+			return nil, err
+		}
+		ret := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(ret.X, ret.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return ret, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.Errorf("unsupported key type '%s'", k.Kty)
+}
+
+func (v *JWTVerifier) verifyToken(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	b64 := base64.RawURLEncoding
+	var (
+		hdr      jwtHeader
+		claims   map[string]interface{}
+		raw, sig []byte
+		err      error
+	)
+	if raw, err = b64.DecodeString(parts[0]); err == nil {
+		err = json.Unmarshal(raw, &hdr)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token header")
+	}
+	if sig, err = b64.DecodeString(parts[2]); err != nil {
+		return nil, errors.Wrap(err, "malformed token signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	keys, _ := v.keys.Load().([]jwk)
+	verified := false
+	for _, k := range keys {
+		if (len(hdr.Kid) > 0 && k.kid != hdr.Kid) || (len(k.alg) > 0 && k.alg != hdr.Alg) {
+			continue
+		}
+		if verified = verifyJWTSignature(hdr.Alg, k.key, signed, sig); verified {
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid token signature")
+	}
+	if raw, err = b64.DecodeString(parts[1]); err == nil {
+		err = json.Unmarshal(raw, &claims)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token claims")
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-v.leeway)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if len(v.issuer) > 0 {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return nil, errors.Errorf("unexpected token issuer '%s'", iss)
+		}
+	}
+	if len(v.audience) > 0 && !jwtHasAudience(claims["aud"], v.audience) {
+		return nil, errors.New("token is not issued for audience")
+	}
+	return claims, nil
+}
+
+func jwtHasAudience(aud interface{}, expected string) bool {
+	switch t := aud.(type) {
+	case string:
+		return t == expected
+	case []interface{}:
+		for _, a := range t {
+			if s, _ := a.(string); s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) bool {
+	var h crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		h = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		h = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		h = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signed, sig)
+	default:
+		return false
+	}
+	hasher := h.New()
+	_, _ = hasher.Write(signed)
+	digest := hasher.Sum(nil)
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(pub, h, digest, sig) == nil
+		case "PS":
+			return rsa.VerifyPSS(pub, h, digest, sig, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+//AuthKindMTLS kind of MTLSVerifier
+const AuthKindMTLS = "mtls"
+
+//MTLSVerifier takes identity of verified client certificate
+type MTLSVerifier struct {
+	trustForwarded map[string]struct{}
+	roles          map[string][]string
+}
+
+//MTLSOption ...
+type MTLSOption func(*MTLSVerifier)
+
+var _ AuthVerifier = (*MTLSVerifier)(nil)
+
+//MTLSTrustForwardedFrom peers with these identities (e.g. gateway proxy of server) may forward
+//identity of its own clients with conventions.PeerIdentityHeader
+func MTLSTrustForwardedFrom(identities ...string) MTLSOption {
+	return func(v *MTLSVerifier) {
+		for _, id := range identities {
+			v.trustForwarded[id] = struct{}{}
+		}
+	}
+}
+
+//MTLSWithRoles maps peer identities to roles
+func MTLSWithRoles(identity2roles map[string][]string) MTLSOption {
+	return func(v *MTLSVerifier) {
+		for id, roles := range identity2roles {
+			v.roles[id] = append(v.roles[id], roles...)
+		}
+	}
+}
+
+//NewMTLSVerifier makes verifier of peer certificates; server should require and verify client certificates
+func NewMTLSVerifier(opts ...MTLSOption) *MTLSVerifier {
+	ret := &MTLSVerifier{
+		trustForwarded: make(map[string]struct{}),
+		roles:          make(map[string][]string),
+	}
+	for _, o := range opts {
+		o(ret)
+	}
+	return ret
+}
+
+//Kind impl AuthVerifier
+func (v *MTLSVerifier) Kind() string {
+	return AuthKindMTLS
+}
+
+//Verify impl AuthVerifier
+func (v *MTLSVerifier) Verify(ctx context.Context, md metadata.MD) (*Principal, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil, ErrNoCredentials
+	}
+	if len(tlsInfo.State.VerifiedChains) == 0 {
+		return nil, errors.New("peer certificate is not verified")
+	}
+	identity := PeerCertIdentity(tlsInfo.State.VerifiedChains[0][0])
+	if len(identity) == 0 {
+		return nil, errors.New("peer certificate has no identity")
+	}
+	if _, trusted := v.trustForwarded[identity]; trusted {
+		if fwd := md.Get(conventions.PeerIdentityHeader); len(fwd) > 0 {
+			if len(fwd[0]) == 0 {
+				return nil, ErrNoCredentials
+			}
+			identity = fwd[0]
+		}
+	}
+	return &Principal{
+		Name:  identity,
+		Kind:  AuthKindMTLS,
+		Roles: append([]string(nil), v.roles[identity]...),
+	}, nil
+}
+
+//PeerCertIdentity identity of certificate: common name or first of URI or DNS SANs
+func PeerCertIdentity(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	if cn := cert.Subject.CommonName; len(cn) > 0 {
+		return cn
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
@@ -0,0 +1,248 @@
+package interceptors
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+	"github.com/thataway/common-lib/server/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	//Principal authenticated caller
+	Principal struct {
+		//Name of caller: JWT subject, API key owner or peer certificate identity
+		Name string
+		//Kind of verifier authenticated caller
+		Kind string
+		//Roles of caller
+		Roles []string
+		//Claims of JWT
+		Claims map[string]interface{}
+	}
+
+	//AuthVerifier verifies caller credentials from incoming metadata
+	AuthVerifier interface {
+		//Kind of credentials
+		Kind() string
+		//Verify gives principal; it returns ErrNoCredentials when there are no credentials of its kind
+		Verify(ctx context.Context, md metadata.MD) (*Principal, error)
+	}
+
+	//AuthPolicy policy of authentication for method
+	AuthPolicy int
+
+	//AuthOption ...
+	AuthOption func(*Authenticator) error
+
+	//OnAuthFailedEvent it is sent when caller is not authenticated
+	OnAuthFailedEvent struct {
+		observer.EventType
+		Info conventions.GrpcMethodInfo
+		//Reason is kind of verifier failed or AuthFailedNoCredentials
+		Reason string
+		Err    error
+		Ctx    context.Context
+	}
+
+	//OnAuthFailedEventObserver ...
+	OnAuthFailedEventObserver func(OnAuthFailedEvent)
+)
+
+const (
+	//AuthRequired caller must be authenticated
+	AuthRequired AuthPolicy = iota
+	//AuthOptional caller is authenticated if it has credentials
+	AuthOptional
+	//AuthSkip no authentication
+	AuthSkip
+)
+
+//AuthFailedNoCredentials reason of OnAuthFailedEvent when caller has no credentials
+const AuthFailedNoCredentials = "no_credentials"
+
+//ErrNoCredentials verifier has not found credentials of its kind
+var ErrNoCredentials = errors.New("no credentials")
+
+var (
+	//DefaultAuthSkipMethods health check and reflection need no authentication by default
+	DefaultAuthSkipMethods = []string{
+		"/grpc.health.v1.Health/*",
+		"grpc.reflection.*",
+	}
+)
+
+//AuthWithVerifiers adds verifiers; they are tried in order they are added
+func AuthWithVerifiers(verifiers ...AuthVerifier) AuthOption {
+	return func(a *Authenticator) error {
+		a.verifiers = append(a.verifiers, verifiers...)
+		return nil
+	}
+}
+
+//AuthForMethods sets policy to methods matched by patterns:
+//"*", "package.*", "/package.Service/*" or "/package.Service/Method"; the most specific pattern is applied
+func AuthForMethods(policy AuthPolicy, patterns ...string) AuthOption {
+	return func(a *Authenticator) error {
+		for _, s := range patterns {
+			p, err := parseMethodPattern(s)
+			if err != nil {
+				return err
+			}
+			a.policies = append(a.policies, authMethodPolicy{pattern: p, policy: policy})
+		}
+		return nil
+	}
+}
+
+//AuthWithObservers добавим OnAuthFailedEvent обозревателей
+func AuthWithObservers(obs ...OnAuthFailedEventObserver) AuthOption {
+	return func(a *Authenticator) error {
+		a.observers = append(a.observers, obs...)
+		return nil
+	}
+}
+
+//Authenticator authenticates callers and puts Principal into context
+type Authenticator struct {
+	verifiers []AuthVerifier
+	policies  []authMethodPolicy
+	observers []OnAuthFailedEventObserver
+	subject   observer.Subject
+}
+
+//NewAuthenticator makes authenticator; AuthRequired is default policy except DefaultAuthSkipMethods
+func NewAuthenticator(opts ...AuthOption) (*Authenticator, error) {
+	const api = "NewAuthenticator"
+	ret := new(Authenticator)
+	opts = append([]AuthOption{AuthForMethods(AuthSkip, DefaultAuthSkipMethods...)}, opts...)
+	for _, o := range opts {
+		if err := o(ret); err != nil {
+			return nil, errors.Wrap(err, api)
+		}
+	}
+	if len(ret.observers) > 0 {
+		ret.subject = observer.NewSubject()
+		var evt OnAuthFailedEvent
+		seen := make(map[reflect.Value]bool)
+		for _, obs := range ret.observers {
+			if v := reflect.ValueOf(obs); !seen[v] {
+				seen[v] = true
+			} else {
+				continue
+			}
+			obs := obs
+			o := observer.NewObserver(func(event observer.EventType) {
+				if ev, ok := event.(OnAuthFailedEvent); ok {
+					obs(ev)
+				}
+			}, false, evt)
+			ret.subject.ObserversAttach(o)
+		}
+		ret.observers = nil
+		runtime.SetFinalizer(ret, func(o *Authenticator) {
+			o.subject.DetachAllObservers()
+		})
+	}
+	return ret, nil
+}
+
+//Unary ...
+func (impl *Authenticator) Unary(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := impl.authenticate(ctx, i.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+//Stream stream server interceptor
+func (impl *Authenticator) Stream(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := impl.authenticate(ss.Context(), i.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, internal.ServerStreamWithContext(ctx, ss))
+}
+
+//PrincipalFromContext gets principal authenticated by Authenticator
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+//WithPrincipal puts principal into context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	noteAuditPrincipal(ctx, p)
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+type (
+	principalCtxKey struct{}
+
+	authMethodPolicy struct {
+		pattern methodPattern
+		policy  AuthPolicy
+	}
+)
+
+func (impl *Authenticator) policyOf(mi conventions.GrpcMethodInfo) AuthPolicy {
+	ret, best := AuthRequired, -1
+	for _, p := range impl.policies {
+		if n, ok := p.pattern.match(mi); ok && n >= best {
+			ret, best = p.policy, n
+		}
+	}
+	return ret
+}
+
+func (impl *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		if e := mi.Init(method); e != nil {
+			panic(e)
+		}
+	}
+	policy := impl.policyOf(mi)
+	if policy == AuthSkip {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range impl.verifiers {
+		p, err := v.Verify(ctx, md)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			impl.notifyFailure(ctx, mi, v.Kind(), err)
+			return ctx, status.Errorf(codes.Unauthenticated, "%s: %v", v.Kind(), err)
+		}
+		if len(p.Kind) == 0 {
+			p.Kind = v.Kind()
+		}
+		return WithPrincipal(ctx, p), nil
+	}
+	if policy == AuthOptional {
+		return ctx, nil
+	}
+	impl.notifyFailure(ctx, mi, AuthFailedNoCredentials, ErrNoCredentials)
+	return ctx, status.Error(codes.Unauthenticated, ErrNoCredentials.Error())
+}
+
+func (impl *Authenticator) notifyFailure(ctx context.Context, mi conventions.GrpcMethodInfo, reason string, err error) {
+	if subj := impl.subject; subj != nil {
+		subj.Notify(OnAuthFailedEvent{
+			Info:   mi,
+			Reason: reason,
+			Err:    err,
+			Ctx:    ctx,
+		})
+	}
+}
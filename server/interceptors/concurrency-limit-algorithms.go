@@ -0,0 +1,128 @@
+package interceptors
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+//ConcurrencyLimitAlgorithm algorithm gives max number of in-flight calls
+type ConcurrencyLimitAlgorithm interface {
+	//Limit current max number of in-flight calls
+	Limit() int
+	//OnSample is called when call is finished; 'dropped' is true when call got deadline exceeded
+	OnSample(rtt time.Duration, inFlight int, dropped bool)
+}
+
+//FixedConcurrencyLimit limit does not change
+func FixedConcurrencyLimit(limit int) ConcurrencyLimitAlgorithm {
+	return fixedLimit(limit)
+}
+
+//NewAIMDConcurrencyLimit limit grows additively while calls are faster than 'latencyThreshold'
+//and decreases multiplicatively when calls are slower or dropped
+func NewAIMDConcurrencyLimit(initial, min, max int, latencyThreshold time.Duration) ConcurrencyLimitAlgorithm {
+	ret := &aimdLimit{
+		latencyThreshold: latencyThreshold,
+		backoffRatio:     0.9,
+	}
+	ret.init(initial, min, max)
+	return ret
+}
+
+//NewGradientConcurrencyLimit limit follows ratio of long term latency to the latest one
+func NewGradientConcurrencyLimit(initial, min, max int) ConcurrencyLimitAlgorithm {
+	ret := &gradientLimit{
+		smoothing:  0.2,
+		longWindow: 600,
+	}
+	ret.init(initial, min, max)
+	return ret
+}
+
+type (
+	fixedLimit int
+
+	adaptiveLimit struct {
+		mx    sync.Mutex
+		limit float64
+		min   float64
+		max   float64
+	}
+
+	aimdLimit struct {
+		adaptiveLimit
+		latencyThreshold time.Duration
+		backoffRatio     float64
+	}
+
+	gradientLimit struct {
+		adaptiveLimit
+		smoothing  float64
+		longWindow float64
+		longRTT    float64
+	}
+)
+
+func (l fixedLimit) Limit() int {
+	return int(l)
+}
+
+func (l fixedLimit) OnSample(_ time.Duration, _ int, _ bool) {}
+
+func (l *adaptiveLimit) init(initial, min, max int) {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	l.min, l.max = float64(min), float64(max)
+	l.limit = l.clamp(float64(initial))
+}
+
+func (l *adaptiveLimit) clamp(v float64) float64 {
+	return math.Max(l.min, math.Min(l.max, v))
+}
+
+//Limit impl ConcurrencyLimitAlgorithm
+func (l *adaptiveLimit) Limit() int {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return int(l.limit)
+}
+
+//OnSample impl ConcurrencyLimitAlgorithm
+func (l *aimdLimit) OnSample(rtt time.Duration, inFlight int, dropped bool) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if dropped || (l.latencyThreshold > 0 && rtt > l.latencyThreshold) {
+		l.limit = l.clamp(l.limit * l.backoffRatio)
+	} else if float64(inFlight)*2 >= l.limit { //grow only if limit is in use
+		l.limit = l.clamp(l.limit + 1/l.limit)
+	}
+}
+
+//OnSample impl ConcurrencyLimitAlgorithm
+func (l *gradientLimit) OnSample(rtt time.Duration, inFlight int, dropped bool) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	short := float64(rtt)
+	if short <= 0 {
+		return
+	}
+	if l.longRTT == 0 {
+		l.longRTT = short
+	} else {
+		l.longRTT += (short - l.longRTT) * 2 / (l.longWindow + 1)
+	}
+	if !dropped && float64(inFlight)*2 < l.limit { //app is limited; there is no sense to change limit
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, l.longRTT/short))
+	if dropped {
+		gradient = 0.5
+	}
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.clamp(l.limit*(1-l.smoothing) + newLimit*l.smoothing)
+}
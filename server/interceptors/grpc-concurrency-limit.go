@@ -0,0 +1,186 @@
+package interceptors
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	//ConcurrencyLimitOption ...
+	ConcurrencyLimitOption func(*ConcurrencyLimiter)
+
+	//ConcurrencyStats snapshot of in-flight calls; Service and Method are empty for global limit
+	ConcurrencyStats struct {
+		Service  string
+		Method   string
+		Limit    int
+		InFlight int
+		Shed     uint64
+	}
+)
+
+//ConcurrencyLimitGlobal limit of in-flight calls of all methods
+func ConcurrencyLimitGlobal(alg ConcurrencyLimitAlgorithm) ConcurrencyLimitOption {
+	return func(l *ConcurrencyLimiter) {
+		l.global.alg = alg
+	}
+}
+
+//ConcurrencyLimitForMethod limit of in-flight calls of method; methods have no own limit are counted by global one only
+func ConcurrencyLimitForMethod(serviceFQN, method string, alg ConcurrencyLimitAlgorithm) ConcurrencyLimitOption {
+	return func(l *ConcurrencyLimiter) {
+		l.methods[serviceFQN+"/"+method] = &concurrencySlot{
+			service: serviceFQN,
+			method:  method,
+			alg:     alg,
+		}
+	}
+}
+
+//ConcurrencyLimiter load shedding: calls over the limit of in-flight calls get Unavailable
+type ConcurrencyLimiter struct {
+	global  concurrencySlot
+	methods map[string]*concurrencySlot //it is not changed after construction
+}
+
+//NewConcurrencyLimiter makes limiter; without options it only counts in-flight calls
+func NewConcurrencyLimiter(opts ...ConcurrencyLimitOption) *ConcurrencyLimiter {
+	ret := &ConcurrencyLimiter{
+		methods: make(map[string]*concurrencySlot),
+	}
+	for _, o := range opts {
+		o(ret)
+	}
+	return ret
+}
+
+//Unary ...
+func (impl *ConcurrencyLimiter) Unary(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	var release func(error)
+	if release, err = impl.acquire(ctx, i.FullMethod, true); err != nil {
+		return nil, err
+	}
+	defer func() {
+		release(err)
+	}()
+	resp, err = handler(ctx, req)
+	return
+}
+
+//Stream stream server interceptor; streams are counted as in-flight calls but their lifetimes
+//are not latency samples of limit algorithms because long-lived streams would cut limits
+func (impl *ConcurrencyLimiter) Stream(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	var release func(error)
+	if release, err = impl.acquire(ss.Context(), i.FullMethod, false); err != nil {
+		return err
+	}
+	defer func() {
+		release(err)
+	}()
+	err = handler(srv, ss)
+	return
+}
+
+//Stats gives snapshot of global and limited methods in-flight calls
+func (impl *ConcurrencyLimiter) Stats() []ConcurrencyStats {
+	ret := make([]ConcurrencyStats, 0, len(impl.methods)+1)
+	ret = append(ret, impl.global.stats())
+	for _, s := range impl.methods {
+		ret = append(ret, s.stats())
+	}
+	sort.Slice(ret[1:], func(i, j int) bool {
+		a, b := ret[i+1], ret[j+1]
+		return a.Service < b.Service || (a.Service == b.Service && a.Method < b.Method)
+	})
+	return ret
+}
+
+type concurrencySlot struct {
+	service  string
+	method   string
+	alg      ConcurrencyLimitAlgorithm
+	inFlight int64
+	shed     uint64
+}
+
+func (s *concurrencySlot) stats() ConcurrencyStats {
+	ret := ConcurrencyStats{
+		Service:  s.service,
+		Method:   s.method,
+		InFlight: int(atomic.LoadInt64(&s.inFlight)),
+		Shed:     atomic.LoadUint64(&s.shed),
+	}
+	if s.alg != nil {
+		ret.Limit = s.alg.Limit()
+	}
+	return ret
+}
+
+func (s *concurrencySlot) tryAcquire() bool {
+	n := atomic.AddInt64(&s.inFlight, 1)
+	if s.alg != nil && n > int64(s.alg.Limit()) {
+		atomic.AddInt64(&s.inFlight, -1)
+		atomic.AddUint64(&s.shed, 1)
+		return false
+	}
+	return true
+}
+
+func (s *concurrencySlot) undo() {
+	atomic.AddInt64(&s.inFlight, -1)
+}
+
+func (s *concurrencySlot) release(rtt time.Duration, dropped, sample bool) {
+	n := atomic.AddInt64(&s.inFlight, -1)
+	if s.alg != nil && sample {
+		s.alg.OnSample(rtt, int(n)+1, dropped)
+	}
+}
+
+//slotOf gives slot of limited method or nil
+func (impl *ConcurrencyLimiter) slotOf(ctx context.Context, method string) (*concurrencySlot, error) {
+	if len(impl.methods) == 0 {
+		return nil, nil
+	}
+	var info conventions.GrpcMethodInfo
+	if !info.FromContext(ctx) {
+		if e := info.Init(method); e != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "bad method '%s': %v", method, e)
+		}
+	}
+	return impl.methods[info.ServiceFQN+"/"+info.Method], nil
+}
+
+//acquire takes in-flight slots of call; sample tells call duration is latency sample of limit algorithms
+func (impl *ConcurrencyLimiter) acquire(ctx context.Context, method string, sample bool) (func(error), error) {
+	slot, err := impl.slotOf(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	if !impl.global.tryAcquire() {
+		if slot != nil {
+			atomic.AddUint64(&slot.shed, 1)
+		}
+		return nil, status.Errorf(codes.Unavailable, "server is overloaded; '%s' is shed", method)
+	}
+	if slot != nil && !slot.tryAcquire() {
+		impl.global.undo()
+		return nil, status.Errorf(codes.Unavailable, "too many in-flight calls; '%s' is shed", method)
+	}
+	started := time.Now()
+	return func(err error) {
+		rtt := time.Since(started)
+		dropped := status.Code(err) == codes.DeadlineExceeded
+		if slot != nil {
+			slot.release(rtt, dropped, sample)
+		}
+		impl.global.release(rtt, dropped, sample)
+	}, nil
+}
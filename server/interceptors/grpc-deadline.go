@@ -0,0 +1,171 @@
+package interceptors
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/server/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//DeadlineOption ...
+type DeadlineOption func(*deadlineOptions)
+
+//DeadlineDefault default and max timeouts of every method has no own ones;
+//zero default means call without deadline is not limited, zero max means deadline of call is not clamped
+func DeadlineDefault(def, max time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		o.def = deadlineLimits{def: def, max: max}
+	}
+}
+
+//DeadlineForService default and max timeouts of all methods of service
+func DeadlineForService(serviceFQN string, def, max time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		o.services[serviceFQN] = deadlineLimits{def: def, max: max}
+	}
+}
+
+//DeadlineForMethod default and max timeouts of method of service
+func DeadlineForMethod(serviceFQN, method string, def, max time.Duration) DeadlineOption {
+	return func(o *deadlineOptions) {
+		o.methods[serviceFQN+"/"+method] = deadlineLimits{def: def, max: max}
+	}
+}
+
+//DeadlineEnforcer sets deadline to calls have no one and clamps too long ones;
+//deadline comes from client, gateway (HTTP Grpc-Timeout) or conventions.TimeoutHeader whatever is earlier;
+//handler error of call is out of deadline turns to DeadlineExceeded
+type DeadlineEnforcer struct {
+	opts deadlineOptions
+}
+
+//NewDeadlineEnforcer makes deadline enforcer
+func NewDeadlineEnforcer(opts ...DeadlineOption) *DeadlineEnforcer {
+	ret := &DeadlineEnforcer{
+		opts: deadlineOptions{
+			services: make(map[string]deadlineLimits),
+			methods:  make(map[string]deadlineLimits),
+		},
+	}
+	for _, o := range opts {
+		o(&ret.opts)
+	}
+	return ret
+}
+
+//Unary ...
+func (impl *DeadlineEnforcer) Unary(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx1, cancel := impl.enforce(ctx, i.FullMethod)
+	defer cancel()
+	resp, err := handler(ctx1, req)
+	return resp, deadlineExceeded(ctx1, err)
+}
+
+//Stream stream server interceptor
+func (impl *DeadlineEnforcer) Stream(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := impl.enforce(ss.Context(), i.FullMethod)
+	defer cancel()
+	err := handler(srv, internal.ServerStreamWithContext(ctx, ss))
+	return deadlineExceeded(ctx, err)
+}
+
+type (
+	deadlineLimits struct {
+		def time.Duration
+		max time.Duration
+	}
+
+	deadlineOptions struct {
+		def      deadlineLimits
+		services map[string]deadlineLimits
+		methods  map[string]deadlineLimits
+	}
+)
+
+func (o deadlineOptions) limitsOf(mi conventions.GrpcMethodInfo) deadlineLimits {
+	if l, ok := o.methods[mi.ServiceFQN+"/"+mi.Method]; ok {
+		return l
+	}
+	if l, ok := o.services[mi.ServiceFQN]; ok {
+		return l
+	}
+	return o.def
+}
+
+func (impl *DeadlineEnforcer) enforce(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		if e := mi.Init(method); e != nil {
+			panic(e)
+		}
+	}
+	limits := impl.opts.limitsOf(mi)
+	var (
+		timeout time.Duration
+		has     bool
+	)
+	if d, ok := ctx.Deadline(); ok {
+		timeout, has = time.Until(d), true
+	}
+	if t, ok := timeoutFromMD(ctx); ok && (!has || t < timeout) {
+		timeout, has = t, true
+	}
+	if !has && limits.def > 0 {
+		timeout, has = limits.def, true
+	}
+	if limits.max > 0 && (!has || timeout > limits.max) {
+		timeout, has = limits.max, true
+	}
+	if !has {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func deadlineExceeded(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if status.Code(err) == codes.DeadlineExceeded {
+		return err
+	}
+	return status.Error(codes.DeadlineExceeded, err.Error())
+}
+
+func timeoutFromMD(ctx context.Context) (time.Duration, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(conventions.TimeoutHeader)
+	if len(v) == 0 {
+		return 0, false
+	}
+	t, err := parseTimeout(v[0])
+	return t, err == nil && t > 0
+}
+
+//parseTimeout parses grpc-timeout value (digits and unit H M S m u n) or Go duration otherwise
+func parseTimeout(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	if n := len(s); n > 1 {
+		if unit, ok := units[s[n-1]]; ok {
+			if v, err := strconv.ParseUint(s[:n-1], 10, 63); err == nil {
+				return time.Duration(v) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	return d, errors.Wrapf(err, "bad timeout '%s'", s)
+}
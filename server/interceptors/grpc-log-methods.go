@@ -2,18 +2,44 @@ package interceptors
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/thataway/common-lib/logger"
 	"github.com/thataway/common-lib/pkg/conventions"
 	"github.com/thataway/common-lib/pkg/jsonview"
+	"github.com/thataway/common-lib/server/internal"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 )
 
 type (
-	logCallMethods struct{}
-	represent2log  struct {
+	//APILogOption ...
+	APILogOption func(*APILogger) error
+
+	//APILogPayload how payloads of method are logged
+	APILogPayload int
+
+	//APILogger logs calls of server API: successful ones at debug level and failed ones at error level;
+	//sensitive fields of payloads are hidden by jsonview.DefaultRedactor
+	APILogger struct {
+		maxPayload    int
+		payloads      []apiLogPayloadRule
+		msgSampleRate float64
+	}
+
+	apiLogPayloadRule struct {
+		pattern methodPattern
+		mode    APILogPayload
+	}
+
+	represent2log struct {
 		Service  string      `json:"service"`
 		Method   string      `json:"method"`
 		Duration interface{} `json:"duration"`
@@ -21,13 +47,91 @@ type (
 		Resp     interface{} `json:"resp,omitempty"`
 		Error    interface{} `json:"err,omitempty"`
 	}
+
+	streamMsg2log struct {
+		Service   string      `json:"service"`
+		Method    string      `json:"method"`
+		Direction string      `json:"direction"`
+		Seq       int64       `json:"seq"`
+		Msg       interface{} `json:"msg,omitempty"`
+	}
+
+	//payloadSummary is Truncated when payload is not logged because its size is over max
+	payloadSummary struct {
+		Type      string `json:"type"`
+		Size      int    `json:"size"`
+		Truncated bool   `json:"truncated,omitempty"`
+	}
+
+	truncatedPayload struct {
+		json.Marshaler
+		max int
+	}
+)
+
+const (
+	//APILogPayloadFull payload is logged up to max size; it is default
+	APILogPayloadFull APILogPayload = iota
+	//APILogPayloadSummary only message type and size are logged
+	APILogPayloadSummary
+	//APILogPayloadNone payload is not logged
+	APILogPayloadNone
 )
 
-//LogServerAPI ...
-var LogServerAPI logCallMethods
+//DefaultAPILogMaxPayload max size in bytes of logged payload
+const DefaultAPILogMaxPayload = 64 << 10
+
+//LogServerAPI default API logger
+var LogServerAPI = &APILogger{maxPayload: DefaultAPILogMaxPayload}
+
+//APILogMaxPayload max size in bytes of logged payload; messages are bigger are logged as summary,
+//longer JSON views are truncated; zero or negative means no limit
+func APILogMaxPayload(n int) APILogOption {
+	return func(l *APILogger) error {
+		l.maxPayload = n
+		return nil
+	}
+}
+
+//APILogPayloadOf how payloads of methods are logged; patterns are like in AuthForMethods
+func APILogPayloadOf(mode APILogPayload, methodPatterns ...string) APILogOption {
+	return func(l *APILogger) error {
+		for _, s := range methodPatterns {
+			p, err := parseMethodPattern(s)
+			if err != nil {
+				return err
+			}
+			l.payloads = append(l.payloads, apiLogPayloadRule{pattern: p, mode: mode})
+		}
+		return nil
+	}
+}
+
+//APILogStreamMessages fraction [0, 1] of stream messages are logged at debug level; 0 is default
+func APILogStreamMessages(sampleRate float64) APILogOption {
+	return func(l *APILogger) error {
+		if sampleRate < 0 || sampleRate > 1 {
+			return errors.Errorf("stream messages sample rate %v is out of [0, 1]", sampleRate)
+		}
+		l.msgSampleRate = sampleRate
+		return nil
+	}
+}
+
+//NewAPILogger makes API logger
+func NewAPILogger(opts ...APILogOption) (*APILogger, error) {
+	const api = "NewAPILogger"
+	ret := &APILogger{maxPayload: DefaultAPILogMaxPayload}
+	for _, o := range opts {
+		if err := o(ret); err != nil {
+			return nil, errors.Wrap(err, api)
+		}
+	}
+	return ret, nil
+}
 
 //Unary ...
-func (logCallMethods) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+func (l *APILogger) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	timePoint := time.Now()
 	resp, err := handler(ctx, req)
 	log := logger.FromContext(ctx)
@@ -38,18 +142,19 @@ func (logCallMethods) Unary(ctx context.Context, req interface{}, info *grpc.Una
 	if doLog {
 		var mi conventions.GrpcMethodInfo
 		if mi.Init(info.FullMethod) == nil {
+			mode := l.payloadModeOf(mi)
 			rep := represent2log{
 				Service:  mi.ServiceFQN,
 				Method:   mi.Method,
 				Duration: jsonview.Marshaler(time.Since(timePoint)),
-				Req:      jsonview.Marshaler(req),
+				Req:      l.payloadView(mode, req),
 			}
 			const (
 				msg     = "Unary/SERVER-API"
 				details = "details"
 			)
 			if err == nil {
-				rep.Resp = jsonview.Marshaler(resp)
+				rep.Resp = l.payloadView(mode, resp)
 				log.Debugw(msg, details, rep)
 			} else {
 				rep.Error = jsonview.Marshaler(err)
@@ -61,34 +166,110 @@ func (logCallMethods) Unary(ctx context.Context, req interface{}, info *grpc.Una
 }
 
 //Stream ...
-func (logCallMethods) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+func (l *APILogger) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	timePoint := time.Now()
 	ctx := ss.Context()
+	log := logger.FromContext(ctx)
+	var mi conventions.GrpcMethodInfo
+	miErr := mi.Init(info.FullMethod)
+	if miErr == nil && l.msgSampleRate > 0 && log.Enabled(zap.DebugLevel) {
+		if mode := l.payloadModeOf(mi); mode != APILogPayloadNone {
+			ss = l.streamWithMessagesLog(ss, mi, mode, log)
+		}
+	}
 	err := handler(srv, ss)
 
-	log := logger.FromContext(ctx)
 	doLog := (err != nil && log.Enabled(zap.ErrorLevel)) ||
 		(err == nil && log.Enabled(zap.DebugLevel))
 
-	if doLog {
-		var mi conventions.GrpcMethodInfo
-		if mi.Init(info.FullMethod) == nil {
-			rep := represent2log{
-				Service:  mi.ServiceFQN,
-				Method:   mi.Method,
-				Duration: jsonview.Marshaler(time.Since(timePoint)),
+	if doLog && miErr == nil {
+		rep := represent2log{
+			Service:  mi.ServiceFQN,
+			Method:   mi.Method,
+			Duration: jsonview.Marshaler(time.Since(timePoint)),
+		}
+		const (
+			msg     = "Stream/SERVER-API"
+			details = "details"
+		)
+		if err == nil {
+			log.Debugw(msg, details, rep)
+		} else {
+			rep.Error = jsonview.Marshaler(err)
+			log.Errorw(msg, details, rep)
+		}
+	}
+	return err
+}
+
+func (l *APILogger) payloadModeOf(mi conventions.GrpcMethodInfo) APILogPayload {
+	ret, best := APILogPayloadFull, -1
+	for _, r := range l.payloads {
+		if n, ok := r.pattern.match(mi); ok && n >= best {
+			ret, best = r.mode, n
+		}
+	}
+	return ret
+}
+
+func (l *APILogger) payloadView(mode APILogPayload, d interface{}) interface{} {
+	if d == nil {
+		return nil
+	}
+	switch mode {
+	case APILogPayloadNone:
+		return nil
+	case APILogPayloadSummary:
+		return summaryOf(d)
+	}
+	if m, ok := d.(proto.Message); ok && l.maxPayload > 0 && proto.Size(m) > l.maxPayload {
+		ret := summaryOf(d) //it is not marshalled at all
+		ret.Truncated = true
+		return ret
+	}
+	return truncatedPayload{Marshaler: jsonview.Redacted(d), max: l.maxPayload}
+}
+
+func summaryOf(d interface{}) payloadSummary {
+	ret := payloadSummary{Type: fmt.Sprintf("%T", d)}
+	if m, ok := d.(proto.Message); ok {
+		ret.Type, ret.Size = string(m.ProtoReflect().Descriptor().FullName()), proto.Size(m)
+	}
+	return ret
+}
+
+func (l *APILogger) streamWithMessagesLog(ss grpc.ServerStream, mi conventions.GrpcMethodInfo, mode APILogPayload, log logger.TypeOfLogger) grpc.ServerStream {
+	var sent, received int64
+	hook := func(direction string, seq *int64) func(interface{}, error) {
+		return func(m interface{}, err error) {
+			if err != nil {
+				return
 			}
-			const (
-				msg     = "Stream/SERVER-API"
-				details = "details"
-			)
-			if err == nil {
-				log.Debugw(msg, details, rep)
-			} else {
-				rep.Error = jsonview.Marshaler(err)
-				log.Errorw(msg, details, rep)
+			n := atomic.AddInt64(seq, 1)
+			if rand.Float64() >= l.msgSampleRate { //nolint:gosec
+				return
 			}
+			log.Debugw("Stream/SERVER-API/MSG", "details", streamMsg2log{
+				Service:   mi.ServiceFQN,
+				Method:    mi.Method,
+				Direction: direction,
+				Seq:       n,
+				Msg:       l.payloadView(mode, m),
+			})
 		}
 	}
-	return err
+	return internal.ServerStreamWithHooks(ss, internal.ServerStreamHooks{
+		OnSend: hook("sent", &sent),
+		OnRecv: hook("received", &received),
+	})
+}
+
+//MarshalJSON payload is longer than max size turns to string with truncation marker
+func (p truncatedPayload) MarshalJSON() ([]byte, error) {
+	b, err := p.Marshaler.MarshalJSON()
+	if err != nil || p.max <= 0 || len(b) <= p.max {
+		return b, err
+	}
+	s := strings.ToValidUTF8(string(b[:p.max]), "")
+	return json.Marshal(fmt.Sprintf("%s...[truncated %v of %v bytes]", s, len(b)-p.max, len(b)))
 }
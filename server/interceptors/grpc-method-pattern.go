@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/pkg/conventions"
+)
+
+//methodPattern matches GRPC methods; possible forms:
+//  "*" - any method
+//  "package.*" - any method of any service in package and its subpackages
+//  "/package.Service/*" - any method of service
+//  "/package.Service/Method" - exact method
+type methodPattern struct {
+	source  string
+	pkg     string
+	service string
+	method  string
+}
+
+func parseMethodPattern(s string) (methodPattern, error) {
+	const api = "parseMethodPattern"
+	ret := methodPattern{source: strings.TrimSpace(s)}
+	src := ret.source
+	switch {
+	case src == "*" || src == "/*":
+	case strings.HasSuffix(src, "/*"):
+		ret.service = strings.Trim(strings.TrimSuffix(src, "/*"), "/")
+		if len(ret.service) == 0 || strings.ContainsAny(ret.service, "/*") {
+			return ret, errors.Errorf("%s: invalid pattern '%s'", api, s)
+		}
+	case strings.HasSuffix(src, ".*"):
+		ret.pkg = strings.TrimPrefix(strings.TrimSuffix(src, ".*"), "/")
+		if len(ret.pkg) == 0 || strings.ContainsAny(ret.pkg, "/*") {
+			return ret, errors.Errorf("%s: invalid pattern '%s'", api, s)
+		}
+	default:
+		if !strings.HasPrefix(src, "/") {
+			src = "/" + src
+		}
+		var mi conventions.GrpcMethodInfo
+		if err := mi.Init(src); err != nil {
+			return ret, errors.Wrapf(err, "%s: invalid pattern '%s'", api, s)
+		}
+		ret.service, ret.method = mi.ServiceFQN, mi.Method
+	}
+	return ret, nil
+}
+
+//match returns if pattern matches method and its specificity; more specific pattern has greater value
+func (p methodPattern) match(mi conventions.GrpcMethodInfo) (int, bool) {
+	switch {
+	case len(p.method) > 0:
+		return 3, p.service == mi.ServiceFQN && p.method == mi.Method
+	case len(p.service) > 0:
+		return 2, p.service == mi.ServiceFQN
+	case len(p.pkg) > 0:
+		ok := mi.Package == p.pkg || strings.HasPrefix(mi.Package, p.pkg+".")
+		return 1, ok
+	}
+	return 0, true
+}
+
+func (p methodPattern) String() string {
+	return p.source
+}
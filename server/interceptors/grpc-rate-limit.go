@@ -0,0 +1,288 @@
+package interceptors
+
+import (
+	"context"
+	"math"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	//RateLimitOption ...
+	RateLimitOption func(*rateLimitOptions)
+
+	//RateLimitKey what token buckets are keyed by
+	RateLimitKey int
+
+	//OnRateLimitedEvent it is sent when call is rejected by rate limiter
+	OnRateLimitedEvent struct {
+		observer.EventType
+		Info       conventions.GrpcMethodInfo
+		Key        string
+		RetryAfter time.Duration
+		Ctx        context.Context
+	}
+
+	//OnRateLimitedEventObserver ...
+	OnRateLimitedEventObserver func(OnRateLimitedEvent)
+)
+
+const (
+	//RateLimitByClientName buckets are keyed by client name; peer address is used if client has no name
+	RateLimitByClientName RateLimitKey = iota
+	//RateLimitByPeer buckets are keyed by peer host
+	RateLimitByPeer
+)
+
+//RateLimitDefault rate (calls per second) and burst for every method has no own limits;
+//every method has its own bucket per key
+func RateLimitDefault(rate float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.def = mkRateLimit(rate, burst)
+	}
+}
+
+//RateLimitForService rate (calls per second) and burst for all methods of service;
+//all methods of service share one bucket per key
+func RateLimitForService(serviceFQN string, rate float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.services[serviceFQN] = mkRateLimit(rate, burst)
+	}
+}
+
+//RateLimitForMethod rate (calls per second) and burst for method of service
+func RateLimitForMethod(serviceFQN, method string, rate float64, burst int) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.methods[serviceFQN+"/"+method] = mkRateLimit(rate, burst)
+	}
+}
+
+//RateLimitKeyBy sets what token buckets are keyed by; RateLimitByClientName is default
+func RateLimitKeyBy(k RateLimitKey) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.keyBy = k
+	}
+}
+
+//RateLimitWithObservers добавим OnRateLimitedEvent обозревателей
+func RateLimitWithObservers(obs ...OnRateLimitedEventObserver) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.observers = append(o.observers, obs...)
+	}
+}
+
+//RateLimiter admission control with token buckets; rejected calls get ResourceExhausted
+//and conventions.RetryPushbackHeader in trailer
+type RateLimiter struct {
+	opts    rateLimitOptions
+	subject observer.Subject
+
+	mx        sync.Mutex
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+}
+
+//NewRateLimiter makes rate limiter; zero or negative rate means no limits
+func NewRateLimiter(opts ...RateLimitOption) *RateLimiter {
+	ret := &RateLimiter{
+		opts: rateLimitOptions{
+			services: make(map[string]rateLimit),
+			methods:  make(map[string]rateLimit),
+		},
+		buckets:   make(map[bucketKey]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+	for _, o := range opts {
+		o(&ret.opts)
+	}
+	if len(ret.opts.observers) > 0 {
+		ret.subject = observer.NewSubject()
+		var evt OnRateLimitedEvent
+		seen := make(map[reflect.Value]bool)
+		for _, obs := range ret.opts.observers {
+			if v := reflect.ValueOf(obs); !seen[v] {
+				seen[v] = true
+			} else {
+				continue
+			}
+			obs := obs
+			o := observer.NewObserver(func(event observer.EventType) {
+				if ev, ok := event.(OnRateLimitedEvent); ok {
+					obs(ev)
+				}
+			}, false, evt)
+			ret.subject.ObserversAttach(o)
+		}
+		ret.opts.observers = nil
+		runtime.SetFinalizer(ret, func(o *RateLimiter) {
+			o.subject.DetachAllObservers()
+		})
+	}
+	return ret
+}
+
+//Unary ...
+func (impl *RateLimiter) Unary(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if retryAfter, rejected := impl.admit(ctx, i.FullMethod); rejected {
+		_ = grpc.SetTrailer(ctx, pushbackMD(retryAfter))
+		return nil, impl.rejection(ctx, i.FullMethod, retryAfter)
+	}
+	return handler(ctx, req)
+}
+
+//Stream stream server interceptor
+func (impl *RateLimiter) Stream(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if retryAfter, rejected := impl.admit(ss.Context(), i.FullMethod); rejected {
+		ss.SetTrailer(pushbackMD(retryAfter))
+		return impl.rejection(ss.Context(), i.FullMethod, retryAfter)
+	}
+	return handler(srv, ss)
+}
+
+type (
+	rateLimit struct {
+		rate  float64
+		burst int
+	}
+
+	rateLimitOptions struct {
+		def       rateLimit
+		services  map[string]rateLimit
+		methods   map[string]rateLimit
+		keyBy     RateLimitKey
+		observers []OnRateLimitedEventObserver
+	}
+
+	bucketKey struct {
+		scope string
+		key   string
+	}
+
+	tokenBucket struct {
+		limit  rateLimit
+		tokens float64
+		last   time.Time
+	}
+)
+
+const rateLimitSweepInterval = time.Minute
+
+func mkRateLimit(rate float64, burst int) rateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	return rateLimit{rate: rate, burst: burst}
+}
+
+func (l rateLimit) unlimited() bool {
+	return l.rate <= 0
+}
+
+func (impl *RateLimiter) limitOf(info conventions.GrpcMethodInfo) (string, rateLimit) {
+	if l, ok := impl.opts.methods[info.ServiceFQN+"/"+info.Method]; ok {
+		return info.ServiceFQN + "/" + info.Method, l
+	}
+	if l, ok := impl.opts.services[info.ServiceFQN]; ok {
+		return info.ServiceFQN, l
+	}
+	return info.ServiceFQN + "/" + info.Method, impl.opts.def
+}
+
+func (impl *RateLimiter) keyOf(ctx context.Context) string {
+	if impl.opts.keyBy == RateLimitByClientName {
+		if name := conventions.ClientName.Incoming(ctx, ""); len(name) > 0 {
+			return name
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host
+		}
+		return addr
+	}
+	return "unknown"
+}
+
+func (impl *RateLimiter) methodInfo(ctx context.Context, method string) conventions.GrpcMethodInfo {
+	var info conventions.GrpcMethodInfo
+	if !info.FromContext(ctx) {
+		if e := info.Init(method); e != nil {
+			panic(e)
+		}
+	}
+	return info
+}
+
+func (impl *RateLimiter) admit(ctx context.Context, method string) (time.Duration, bool) {
+	scope, limit := impl.limitOf(impl.methodInfo(ctx, method))
+	if limit.unlimited() {
+		return 0, false
+	}
+	key := bucketKey{scope: scope, key: impl.keyOf(ctx)}
+	now := time.Now()
+	impl.mx.Lock()
+	defer impl.mx.Unlock()
+	if now.Sub(impl.lastSweep) >= rateLimitSweepInterval {
+		impl.lastSweep = now
+		for k, b := range impl.buckets {
+			if b.refill(now) >= float64(b.limit.burst) {
+				delete(impl.buckets, k)
+			}
+		}
+	}
+	b := impl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.burst), last: now}
+		impl.buckets[key] = b
+	}
+	return b.take(now)
+}
+
+func (impl *RateLimiter) rejection(ctx context.Context, method string, retryAfter time.Duration) error {
+	info := impl.methodInfo(ctx, method)
+	if subj := impl.subject; subj != nil {
+		subj.Notify(OnRateLimitedEvent{
+			Info:       info,
+			Key:        impl.keyOf(ctx),
+			RetryAfter: retryAfter,
+			Ctx:        ctx,
+		})
+	}
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for '%s'; retry after %v",
+		info, retryAfter)
+}
+
+func (b *tokenBucket) refill(now time.Time) float64 {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.burst), b.tokens+elapsed.Seconds()*b.limit.rate)
+		b.last = now
+	}
+	return b.tokens
+}
+
+func (b *tokenBucket) take(now time.Time) (time.Duration, bool) {
+	if b.refill(now) >= 1 {
+		b.tokens--
+		return 0, false
+	}
+	need := (1 - b.tokens) / b.limit.rate
+	return time.Duration(math.Ceil(need * float64(time.Second))), true
+}
+
+func pushbackMD(retryAfter time.Duration) metadata.MD {
+	ms := int64(math.Ceil(float64(retryAfter) / float64(time.Millisecond)))
+	return metadata.Pairs(conventions.RetryPushbackHeader, strconv.FormatInt(ms, 10))
+}
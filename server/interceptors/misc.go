@@ -4,8 +4,9 @@ package interceptors
 type DefInterceptor int
 
 const (
-	DefRecovery         DefInterceptor                                        = 1 << iota //nolint
-	DefLogLevelOverride                                                                   //nolint
-	DefLogServerAPI                                                                       //nolint
-	DefAll              = DefLogLevelOverride | DefRecovery | DefLogServerAPI             //nolint
+	DefRecovery         DefInterceptor                                                              = 1 << iota //nolint
+	DefLogLevelOverride                                                                                         //nolint
+	DefLogServerAPI                                                                                             //nolint
+	DefConcurrencyLimit                                                                                         //nolint
+	DefAll              = DefLogLevelOverride | DefRecovery | DefLogServerAPI | DefConcurrencyLimit             //nolint
 )
@@ -0,0 +1,369 @@
+package interceptors
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thataway/common-lib/logger"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	//RBACPolicy role based access policy; it is loaded from YAML or JSON
+	RBACPolicy struct {
+		//Default decision when no rule matches method: "allow" or "deny"(default)
+		Default string `yaml:"default"`
+		//Rules allow access to methods
+		Rules []RBACRule `yaml:"rules"`
+	}
+
+	//RBACRule allows access to methods for principals have any of roles or names;
+	//"*" in Roles means any authenticated principal;
+	//method patterns are "*", "package.*", "/package.Service/*" or "/package.Service/Method"
+	RBACRule struct {
+		Methods         []string `yaml:"methods"`
+		Roles           []string `yaml:"roles"`
+		Principals      []string `yaml:"principals"`
+		Unauthenticated bool     `yaml:"unauthenticated"`
+	}
+
+	//RBACOption ...
+	RBACOption func(*RBAC) error
+)
+
+const (
+	//RBACAllow decision
+	RBACAllow = "allow"
+	//RBACDeny decision
+	RBACDeny = "deny"
+
+	//DefaultRBACReloadInterval default interval to check policy file changes
+	DefaultRBACReloadInterval = 10 * time.Second
+)
+
+var (
+	//DefaultRBACSkipMethods health check and reflection are not authorized by default like DefaultAuthSkipMethods
+	DefaultRBACSkipMethods = []string{
+		"/grpc.health.v1.Health/*",
+		"grpc.reflection.*",
+	}
+)
+
+//RBACWithPolicy sets policy
+func RBACWithPolicy(p RBACPolicy) RBACOption {
+	return func(r *RBAC) error {
+		return r.SetPolicy(p)
+	}
+}
+
+//RBACWithPolicyFile loads policy from YAML or JSON file; RBAC.Watch reloads it on changes
+func RBACWithPolicyFile(fileName string) RBACOption {
+	return func(r *RBAC) error {
+		r.policyFile = fileName
+		return r.Reload()
+	}
+}
+
+//RBACWithReloadInterval sets interval to check policy file changes
+func RBACWithReloadInterval(d time.Duration) RBACOption {
+	return func(r *RBAC) error {
+		r.reloadInterval = d
+		return nil
+	}
+}
+
+//RBACSkipMethods methods matched by patterns are not authorized; they replace DefaultRBACSkipMethods
+func RBACSkipMethods(patterns ...string) RBACOption {
+	return func(r *RBAC) error {
+		r.skip = r.skip[:0]
+		for _, s := range patterns {
+			p, err := parseMethodPattern(s)
+			if err != nil {
+				return err
+			}
+			r.skip = append(r.skip, p)
+		}
+		return nil
+	}
+}
+
+//RBACAuditAllowed audit log has allowed calls too; denied calls are logged always
+func RBACAuditAllowed() RBACOption {
+	return func(r *RBAC) error {
+		r.auditAllowed = true
+		return nil
+	}
+}
+
+//RBAC method level authorization of principal put into context by Authenticator
+type RBAC struct {
+	policyFile     string
+	reloadInterval time.Duration
+	auditAllowed   bool
+	skip           []methodPattern
+	policy         atomic.Value
+
+	mx        sync.Mutex
+	fileStamp struct {
+		modTime time.Time
+		size    int64
+	}
+}
+
+//NewRBAC makes RBAC interceptor; DefaultRBACSkipMethods are not authorized unless RBACSkipMethods is given
+func NewRBAC(opts ...RBACOption) (*RBAC, error) {
+	const api = "NewRBAC"
+	ret := &RBAC{reloadInterval: DefaultRBACReloadInterval}
+	ret.policy.Store(&compiledRBACPolicy{})
+	opts = append([]RBACOption{RBACSkipMethods(DefaultRBACSkipMethods...)}, opts...)
+	for _, o := range opts {
+		if err := o(ret); err != nil {
+			return nil, errors.Wrap(err, api)
+		}
+	}
+	return ret, nil
+}
+
+//SetPolicy replaces policy
+func (r *RBAC) SetPolicy(p RBACPolicy) error {
+	const api = "RBAC.SetPolicy"
+	compiled, err := compileRBACPolicy(p)
+	if err != nil {
+		return errors.Wrap(err, api)
+	}
+	r.policy.Store(compiled)
+	return nil
+}
+
+//Reload reloads policy from file
+func (r *RBAC) Reload() error {
+	const api = "RBAC.Reload"
+	if len(r.policyFile) == 0 {
+		return errors.Errorf("%s: no policy file", api)
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	st, err := os.Stat(r.policyFile)
+	if err != nil {
+		return errors.Wrap(err, api)
+	}
+	var data []byte
+	if data, err = ioutil.ReadFile(r.policyFile); err != nil {
+		return errors.Wrap(err, api)
+	}
+	var p RBACPolicy
+	if err = yaml.Unmarshal(data, &p); err != nil {
+		return errors.Wrapf(err, "%s: parse '%s'", api, r.policyFile)
+	}
+	if err = r.SetPolicy(p); err != nil {
+		return errors.Wrap(err, api)
+	}
+	r.fileStamp.modTime, r.fileStamp.size = st.ModTime(), st.Size()
+	return nil
+}
+
+//Watch reloads policy file when it changes until context is done; failed reload keeps current policy
+func (r *RBAC) Watch(ctx context.Context) error {
+	if len(r.policyFile) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(r.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		changed, err := r.policyFileChanged()
+		if !changed {
+			continue
+		}
+		if err == nil {
+			err = r.Reload()
+		}
+		if err != nil {
+			logger.ErrorKV(ctx, "RBAC", "policy-file", r.policyFile, "cause", err.Error())
+		} else {
+			logger.InfoKV(ctx, "RBAC", "policy-file", r.policyFile, "status", "reloaded")
+		}
+	}
+}
+
+func (r *RBAC) policyFileChanged() (bool, error) {
+	st, err := os.Stat(r.policyFile)
+	if err != nil {
+		return true, err
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return !st.ModTime().Equal(r.fileStamp.modTime) || st.Size() != r.fileStamp.size, nil
+}
+
+//Unary ...
+func (r *RBAC) Unary(ctx context.Context, req interface{}, i *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := r.authorize(ctx, i.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+//Stream stream server interceptor
+func (r *RBAC) Stream(srv interface{}, ss grpc.ServerStream, i *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := r.authorize(ss.Context(), i.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+type (
+	compiledRBACPolicy struct {
+		allowByDefault bool
+		rules          []compiledRBACRule
+	}
+
+	compiledRBACRule struct {
+		patterns        []methodPattern
+		anyRole         bool
+		roles           map[string]struct{}
+		principals      map[string]struct{}
+		unauthenticated bool
+	}
+)
+
+func compileRBACPolicy(p RBACPolicy) (*compiledRBACPolicy, error) {
+	ret := new(compiledRBACPolicy)
+	switch strings.ToLower(strings.TrimSpace(p.Default)) {
+	case RBACAllow:
+		ret.allowByDefault = true
+	case RBACDeny, "":
+	default:
+		return nil, errors.Errorf("unknown default decision '%s'", p.Default)
+	}
+	for i, rule := range p.Rules {
+		c := compiledRBACRule{
+			roles:           make(map[string]struct{}),
+			principals:      make(map[string]struct{}),
+			unauthenticated: rule.Unauthenticated,
+		}
+		if len(rule.Methods) == 0 {
+			return nil, errors.Errorf("rule #%v has no methods", i)
+		}
+		for _, m := range rule.Methods {
+			pat, err := parseMethodPattern(m)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule #%v", i)
+			}
+			c.patterns = append(c.patterns, pat)
+		}
+		for _, role := range rule.Roles {
+			if role == "*" {
+				c.anyRole = true
+			}
+			c.roles[role] = struct{}{}
+		}
+		for _, name := range rule.Principals {
+			c.principals[name] = struct{}{}
+		}
+		ret.rules = append(ret.rules, c)
+	}
+	return ret, nil
+}
+
+func (rule compiledRBACRule) specificity(mi conventions.GrpcMethodInfo) int {
+	ret := -1
+	for _, p := range rule.patterns {
+		if n, ok := p.match(mi); ok && n > ret {
+			ret = n
+		}
+	}
+	return ret
+}
+
+func (rule compiledRBACRule) allows(p *Principal) bool {
+	if p == nil {
+		return rule.unauthenticated
+	}
+	if rule.anyRole || rule.unauthenticated {
+		return true
+	}
+	if _, ok := rule.principals[p.Name]; ok {
+		return true
+	}
+	for _, role := range p.Roles {
+		if _, ok := rule.roles[role]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//decide only rules with the most specific patterns matched method are taken into account
+func (p *compiledRBACPolicy) decide(mi conventions.GrpcMethodInfo, principal *Principal) bool {
+	best, matched, allowed := -1, false, false
+	for _, rule := range p.rules {
+		n := rule.specificity(mi)
+		if n < 0 || n < best {
+			continue
+		}
+		if n > best {
+			best, allowed = n, false
+		}
+		matched = true
+		allowed = allowed || rule.allows(principal)
+	}
+	if !matched {
+		return p.allowByDefault
+	}
+	return allowed
+}
+
+func (r *RBAC) authorize(ctx context.Context, method string) error {
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		if e := mi.Init(method); e != nil {
+			panic(e)
+		}
+	}
+	for _, p := range r.skip {
+		if _, ok := p.match(mi); ok {
+			return nil
+		}
+	}
+	principal, _ := PrincipalFromContext(ctx)
+	policy := r.policy.Load().(*compiledRBACPolicy)
+	allowed := policy.decide(mi, principal)
+	if allowed && !r.auditAllowed {
+		return nil
+	}
+	name, kind, decision := "", "", RBACDeny
+	if principal != nil {
+		name, kind = principal.Name, principal.Kind
+	}
+	if allowed {
+		decision = RBACAllow
+	}
+	kv := []interface{}{
+		"principal", name,
+		"principal-kind", kind,
+		"method", mi.String(),
+		"decision", decision,
+	}
+	if allowed {
+		logger.InfoKV(ctx, "RBAC-AUDIT", kv...)
+		return nil
+	}
+	logger.WarnKV(ctx, "RBAC-AUDIT", kv...)
+	return status.Errorf(codes.PermissionDenied, "access to '%s' is denied", mi)
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/pkg/jsonview"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Auditor(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7206")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var dir string
+	if dir, err = ioutil.TempDir("", "audit"); !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	auditFile := filepath.Join(dir, "audit.log")
+
+	var (
+		auth    *interceptors.Authenticator
+		auditor *interceptors.Auditor
+	)
+	auth, err = interceptors.NewAuthenticator(
+		interceptors.AuthWithVerifiers(interceptors.NewAPIKeyVerifier(map[string]interceptors.Principal{
+			"secret-key": {Name: "robot"},
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	auditor, err = interceptors.NewAuditor(
+		interceptors.AuditToRotatedFile(auditFile, 1<<20, 1),
+		interceptors.AuditRedactFields("value"),
+		interceptors.AuditSamplePayloads(1),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(_ context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) { //nolint:unparam
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	bone.serverOptions = []server.APIServerOption{
+		server.WithUnaryInterceptors(auditor.Unary, auth.Unary),
+		server.WithStreamInterceptors(auditor.Stream, auth.Stream),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			c := metadata.AppendToOutgoingContext(ctx, conventions.APIKeyHeader, "secret-key")
+			_, e = client.Uppercase(c, &strlib.UppercaseQuery{Value: "top-secret"})
+			assert.NoError(t, e)
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "top-secret"})
+			assert.Equal(t, codes.Unauthenticated, status.Code(e))
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, auditor.Close())
+
+	type record struct {
+		Message string `json:"message"`
+		Details struct {
+			Method    string `json:"method"`
+			Principal string `json:"principal"`
+			Code      string `json:"code"`
+			Req       struct {
+				Value string `json:"value"`
+			} `json:"req"`
+		} `json:"details"`
+	}
+	var f *os.File
+	if f, err = os.Open(auditFile); !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close() //nolint
+	var records []record
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var r record
+		if assert.NoError(t, json.Unmarshal(sc.Bytes(), &r)) {
+			records = append(records, r)
+		}
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "Unary/AUDIT", records[0].Message)
+		assert.Equal(t, "Uppercase", records[0].Details.Method)
+		assert.Equal(t, "robot", records[0].Details.Principal)
+		assert.Equal(t, codes.OK.String(), records[0].Details.Code)
+		assert.Equal(t, jsonview.RedactedValue, records[0].Details.Req.Value)
+		assert.Equal(t, "", records[1].Details.Principal)
+		assert.Equal(t, codes.Unauthenticated.String(), records[1].Details.Code)
+	}
+}
+
+func Test_AuditorConcurrentCalls(t *testing.T) {
+	buf := new(bytes.Buffer) //it is not goroutine safe
+	auditor, err := interceptors.NewAuditor(interceptors.AuditToWriter(buf))
+	if !assert.NoError(t, err) {
+		return
+	}
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	const calls = 50
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, e := auditor.Unary(context.Background(), nil,
+				&grpc.UnaryServerInfo{FullMethod: "/some.Service/Method"}, handler)
+			assert.NoError(t, e)
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, auditor.Close())
+	n := 0
+	for sc := bufio.NewScanner(buf); sc.Scan(); n++ {
+		assert.True(t, json.Valid(sc.Bytes()))
+	}
+	assert.Equal(t, calls, n)
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/health_check"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func makeJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	b64 := base64.RawURLEncoding
+	hdr, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	assert.NoError(t, err)
+	var payload []byte
+	payload, err = json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := b64.EncodeToString(hdr) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func writeJWKS(t *testing.T, fileName string, key *rsa.PublicKey, kid string) {
+	b64 := base64.RawURLEncoding
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   b64.EncodeToString(key.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(fileName, data, 0600))
+}
+
+func Test_Authenticator(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7203")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var key *rsa.PrivateKey
+	if key, err = rsa.GenerateKey(rand.Reader, 2048); !assert.NoError(t, err) {
+		return
+	}
+	var dir string
+	if dir, err = ioutil.TempDir("", "jwks"); !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	jwksFile := filepath.Join(dir, "jwks.json")
+	writeJWKS(t, jwksFile, &key.PublicKey, "key-1")
+
+	var jwtVerifier *interceptors.JWTVerifier
+	jwtVerifier, err = interceptors.NewJWTVerifier(jwksFile, interceptors.JWTWithIssuer("test-issuer"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var (
+		failures  int32
+		principal atomic.Value
+	)
+	var auth *interceptors.Authenticator
+	auth, err = interceptors.NewAuthenticator(
+		interceptors.AuthWithVerifiers(
+			jwtVerifier,
+			interceptors.NewAPIKeyVerifier(map[string]interceptors.Principal{
+				"secret-key": {Name: "robot", Roles: []string{"admin"}},
+			}),
+		),
+		interceptors.AuthWithObservers(func(ev interceptors.OnAuthFailedEvent) {
+			atomic.AddInt32(&failures, 1)
+		}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(ctx context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) { //nolint:unparam
+		p, _ := interceptors.PrincipalFromContext(ctx)
+		principal.Store(*p)
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	bone.serverOptions = []server.APIServerOption{
+		server.WithUnaryInterceptors(auth.Unary),
+		server.WithStreamInterceptors(auth.Stream),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			call := func(kv ...string) error {
+				_, e1 := client.Uppercase(metadata.AppendToOutgoingContext(ctx, kv...),
+					&strlib.UppercaseQuery{Value: "abc"})
+				return e1
+			}
+			_, e = health_check.NewClient(conn).Check(ctx, &health_check.Request{})
+			assert.NoError(t, e)
+
+			assert.Equal(t, codes.Unauthenticated, status.Code(call()))
+
+			token := makeJWT(t, key, "key-1", map[string]interface{}{
+				"sub":   "user-1",
+				"iss":   "test-issuer",
+				"exp":   time.Now().Add(time.Minute).Unix(),
+				"roles": []string{"reader", "writer"},
+			})
+			if assert.NoError(t, call(conventions.AuthorizationHeader, "Bearer "+token)) {
+				p := principal.Load().(interceptors.Principal)
+				assert.Equal(t, "user-1", p.Name)
+				assert.Equal(t, interceptors.AuthKindJWT, p.Kind)
+				assert.Equal(t, []string{"reader", "writer"}, p.Roles)
+			}
+			expired := makeJWT(t, key, "key-1", map[string]interface{}{
+				"sub": "user-1",
+				"iss": "test-issuer",
+				"exp": time.Now().Add(-time.Minute).Unix(),
+			})
+			assert.Equal(t, codes.Unauthenticated,
+				status.Code(call(conventions.AuthorizationHeader, "Bearer "+expired)))
+
+			if assert.NoError(t, call(conventions.APIKeyHeader, "secret-key")) {
+				p := principal.Load().(interceptors.Principal)
+				assert.Equal(t, "robot", p.Name)
+				assert.Equal(t, interceptors.AuthKindAPIKey, p.Kind)
+			}
+			assert.Equal(t, codes.Unauthenticated, status.Code(call(conventions.APIKeyHeader, "wrong-key")))
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&failures))
+}
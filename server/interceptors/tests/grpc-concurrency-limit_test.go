@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	prometheusMetrics "github.com/thataway/common-lib/server/metrics/prometheus"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_ConcurrencyLimiter(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7202")
+	if !assert.NoError(t, err) {
+		return
+	}
+	entered, leave := make(chan struct{}, 1), make(chan struct{})
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(_ context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) { //nolint:unparam
+		entered <- struct{}{}
+		<-leave
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	limiter := interceptors.NewConcurrencyLimiter(
+		interceptors.ConcurrencyLimitForMethod(strlib.Strlib_ServiceDesc.ServiceName, "Uppercase",
+			interceptors.FixedConcurrencyLimit(1)),
+	)
+	pm := prometheusMetrics.NewMetrics(prometheusMetrics.WithConcurrencyLimiter(limiter))
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(pm); !assert.NoError(t, err) {
+		return
+	}
+	bone.serverOptions = []server.APIServerOption{
+		server.WithConcurrencyLimiter(limiter),
+		server.WithStatsHandlers(pm.StatHandlers()...),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	metric := func(name string) float64 {
+		families, e := reg.Gather()
+		if !assert.NoError(t, e) {
+			return -1
+		}
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == prometheusMetrics.LabelMethod && l.GetValue() == "Uppercase" {
+						return m.GetGauge().GetValue() + m.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return -1
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			first := make(chan error, 1)
+			go func() {
+				_, e1 := client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+				first <- e1
+			}()
+			<-entered
+			assert.Equal(t, float64(1), metric("sbr_grpc_server_methods_in_flight"))
+			assert.Equal(t, float64(1), metric("sbr_grpc_server_concurrency_limit"))
+
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			assert.Equal(t, codes.Unavailable, status.Code(e))
+			assert.Equal(t, float64(1), metric("sbr_grpc_server_methods_shed"))
+
+			close(leave)
+			assert.NoError(t, <-first)
+			assert.Equal(t, float64(0), metric("sbr_grpc_server_methods_in_flight"))
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
+
+func Test_AIMDConcurrencyLimit(t *testing.T) {
+	alg := interceptors.NewAIMDConcurrencyLimit(10, 2, 20, 100*time.Millisecond)
+	alg.OnSample(time.Second, 10, false)
+	assert.Equal(t, 9, alg.Limit())
+	for i := 0; i < 100; i++ {
+		alg.OnSample(time.Millisecond, alg.Limit(), false)
+	}
+	assert.Greater(t, alg.Limit(), 9)
+	for i := 0; i < 100; i++ {
+		alg.OnSample(time.Millisecond, 1, true)
+	}
+	assert.Equal(t, 2, alg.Limit())
+}
+
+func Test_ConcurrencyLimiterMethods(t *testing.T) {
+	limiter := interceptors.NewConcurrencyLimiter(
+		interceptors.ConcurrencyLimitForMethod(strlib.Strlib_ServiceDesc.ServiceName, "Uppercase",
+			interceptors.FixedConcurrencyLimit(1)),
+	)
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	_, err := limiter.Unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "bad-method"}, handler)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	for i := 0; i < 3; i++ {
+		_, err = limiter.Unary(context.Background(), nil,
+			&grpc.UnaryServerInfo{FullMethod: fmt.Sprintf("/some.Service/Method%v", i)}, handler)
+		assert.NoError(t, err)
+	}
+	stats := limiter.Stats()
+	if assert.Len(t, stats, 2) { //global and limited method only
+		assert.Equal(t, "Uppercase", stats[1].Method)
+	}
+}
+
+type sampleCounter struct {
+	samples int32
+}
+
+func (c *sampleCounter) Limit() int {
+	return 10
+}
+
+func (c *sampleCounter) OnSample(time.Duration, int, bool) {
+	atomic.AddInt32(&c.samples, 1)
+}
+
+func Test_ConcurrencyLimiterStreams(t *testing.T) {
+	alg := new(sampleCounter)
+	limiter := interceptors.NewConcurrencyLimiter(interceptors.ConcurrencyLimitGlobal(alg))
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	_, err := limiter.Unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/some.Service/Unary"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&alg.samples))
+
+	var inFlight int
+	err = limiter.Stream(nil, &fakeServerStream{ctx: context.Background()},
+		&grpc.StreamServerInfo{FullMethod: "/some.Service/Watch"},
+		func(interface{}, grpc.ServerStream) error {
+			inFlight = limiter.Stats()[0].InFlight
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, inFlight)
+	assert.Equal(t, 0, limiter.Stats()[0].InFlight)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&alg.samples)) //stream lifetime is not latency sample
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_DeadlineEnforcer(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7205")
+	if !assert.NoError(t, err) {
+		return
+	}
+	const (
+		defTimeout = time.Second
+		maxTimeout = 2 * time.Second
+	)
+	var remains int64
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(ctx context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+		d, ok := ctx.Deadline()
+		if !ok {
+			atomic.StoreInt64(&remains, -1)
+			return &strlib.UppercaseResponse{}, nil
+		}
+		atomic.StoreInt64(&remains, int64(time.Until(d)))
+		if q.GetValue() == "wait" {
+			<-ctx.Done()
+			return nil, errors.New("interrupted")
+		}
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	enforcer := interceptors.NewDeadlineEnforcer(
+		interceptors.DeadlineForService("strlib.v1.strlib", defTimeout, maxTimeout),
+	)
+	bone.serverOptions = []server.APIServerOption{
+		server.WithUnaryInterceptors(enforcer.Unary),
+		server.WithStreamInterceptors(enforcer.Stream),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	inRange := func(lo, hi time.Duration) bool {
+		r := time.Duration(atomic.LoadInt64(&remains))
+		return r > lo && r <= hi
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+
+			//no deadline -> default one
+			_, e = client.Uppercase(context.Background(), &strlib.UppercaseQuery{Value: "a"})
+			assert.NoError(t, e)
+			assert.True(t, inRange(0, defTimeout))
+
+			//too long deadline -> max one
+			ctx1, cancel1 := context.WithTimeout(context.Background(), time.Hour)
+			_, e = client.Uppercase(ctx1, &strlib.UppercaseQuery{Value: "a"})
+			cancel1()
+			assert.NoError(t, e)
+			assert.True(t, inRange(defTimeout, maxTimeout))
+
+			//timeout header is earlier
+			ctx1 = metadata.AppendToOutgoingContext(ctx, conventions.TimeoutHeader, "300m")
+			_, e = client.Uppercase(ctx1, &strlib.UppercaseQuery{Value: "wait"})
+			assert.Equal(t, codes.DeadlineExceeded, status.Code(e))
+			assert.True(t, inRange(0, 300*time.Millisecond))
+
+			//gateway with HTTP Grpc-Timeout is clamped too
+			var req *retryablehttp.Request
+			if req, e = bone.gwReq2Uppercase(ctx, &strlib.UppercaseQuery{Value: "a"}); !assert.NoError(t, e) {
+				return e
+			}
+			req.Header.Set("Grpc-Timeout", "1H")
+			var resp *http.Response
+			if resp, e = bone.client4GW().Do(req); assert.NoError(t, e) {
+				_ = resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.True(t, inRange(defTimeout, maxTimeout))
+			}
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
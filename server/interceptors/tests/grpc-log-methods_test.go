@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/logger"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type fakeServerStream struct {
+	ctx  context.Context
+	recv []string
+}
+
+func (s *fakeServerStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerStream) SetTrailer(metadata.MD)       {}
+func (s *fakeServerStream) Context() context.Context     { return s.ctx }
+func (s *fakeServerStream) SendMsg(interface{}) error    { return nil }
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	q := m.(*strlib.UppercaseQuery)
+	q.Value, s.recv = s.recv[0], s.recv[1:]
+	return nil
+}
+
+func Test_APILogger(t *testing.T) {
+	const method = "/strlib.v1.strlib/Uppercase"
+	buf := bytes.NewBuffer(nil)
+	ctx := logger.ToContext(context.Background(), logger.NewWithSink(zap.DebugLevel, buf))
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return &strlib.UppercaseResponse{Value: strings.ToUpper(req.(*strlib.UppercaseQuery).GetValue())}, nil
+	}
+	longValue := strings.Repeat("a", 100)
+
+	l, err := interceptors.NewAPILogger(interceptors.APILogMaxPayload(32))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = l.Unary(ctx, &strlib.UppercaseQuery{Value: longValue}, info, handler)
+	assert.NoError(t, err)
+	s := buf.String()
+	assert.Contains(t, s, `"req":{"type":"strlib.v1.UppercaseQuery","size":102,"truncated":true}`)
+	assert.NotContains(t, s, "aaaa")
+
+	buf.Reset()
+	value := strings.Repeat("b", 25) //message fits max size but its JSON does not
+	_, err = l.Unary(ctx, &strlib.UppercaseQuery{Value: value}, info, handler)
+	assert.NoError(t, err)
+	s = buf.String()
+	assert.Contains(t, s, "...[truncated")
+	assert.NotContains(t, s, value)
+
+	buf.Reset()
+	l, err = interceptors.NewAPILogger(interceptors.APILogPayloadOf(interceptors.APILogPayloadSummary, "strlib.v1.*"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = l.Unary(ctx, &strlib.UppercaseQuery{Value: longValue}, info, handler)
+	assert.NoError(t, err)
+	s = buf.String()
+	assert.Contains(t, s, `"type":"strlib.v1.UppercaseQuery"`)
+	assert.NotContains(t, s, "aaaa")
+
+	buf.Reset()
+	l, err = interceptors.NewAPILogger(
+		interceptors.APILogPayloadOf(interceptors.APILogPayloadSummary, "strlib.v1.*"),
+		interceptors.APILogPayloadOf(interceptors.APILogPayloadNone, method),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = l.Unary(ctx, &strlib.UppercaseQuery{Value: longValue}, info, handler)
+	assert.NoError(t, err)
+	s = buf.String()
+	assert.Contains(t, s, "Unary/SERVER-API")
+	assert.NotContains(t, s, `"req"`)
+
+	buf.Reset()
+	l, err = interceptors.NewAPILogger(interceptors.APILogStreamMessages(1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ss := &fakeServerStream{ctx: ctx, recv: []string{"first", "second"}}
+	err = l.Stream(nil, ss, &grpc.StreamServerInfo{FullMethod: method},
+		func(_ interface{}, stream grpc.ServerStream) error {
+			for i := 0; i < 2; i++ {
+				var q strlib.UppercaseQuery
+				if e := stream.RecvMsg(&q); e != nil {
+					return e
+				}
+				if e := stream.SendMsg(&strlib.UppercaseResponse{Value: strings.ToUpper(q.GetValue())}); e != nil {
+					return e
+				}
+			}
+			return nil
+		})
+	assert.NoError(t, err)
+	s = buf.String()
+	assert.Equal(t, 4, strings.Count(s, "Stream/SERVER-API/MSG"))
+	assert.Contains(t, s, `"direction":"received","seq":2,"msg":{"value":"second"}`)
+	assert.Contains(t, s, `"direction":"sent","seq":2,"msg":{"value":"SECOND"}`)
+	assert.Equal(t, 1, strings.Count(s, `"Stream/SERVER-API"`))
+}
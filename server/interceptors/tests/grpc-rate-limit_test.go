@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	prometheusMetrics "github.com/thataway/common-lib/server/metrics/prometheus"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7201")
+	if !assert.NoError(t, err) {
+		return
+	}
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(_ context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) { //nolint:unparam
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	pm := prometheusMetrics.NewMetrics()
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(pm); !assert.NoError(t, err) {
+		return
+	}
+	var rejected int32
+	limiter := interceptors.NewRateLimiter(
+		interceptors.RateLimitForMethod(strlib.Strlib_ServiceDesc.ServiceName, "Uppercase", 0.01, 2),
+		interceptors.RateLimitWithObservers(pm.RateLimitsObserver(), func(ev interceptors.OnRateLimitedEvent) {
+			atomic.AddInt32(&rejected, 1)
+			assert.Equal(t, "client-a", ev.Key)
+		}),
+	)
+	bone.serverOptions = []server.APIServerOption{
+		server.WithUnaryInterceptors(limiter.Unary),
+		server.WithStreamInterceptors(limiter.Stream),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			call := func(clientName string) (metadata.MD, error) {
+				var trailer metadata.MD
+				c := metadata.AppendToOutgoingContext(ctx, conventions.AppNameHeader, clientName)
+				_, e1 := client.Uppercase(c, &strlib.UppercaseQuery{Value: "abc"}, grpc.Trailer(&trailer))
+				return trailer, e1
+			}
+			for i := 0; i < 2; i++ {
+				_, e = call("client-a")
+				assert.NoError(t, e)
+			}
+			var trailer metadata.MD
+			trailer, e = call("client-a")
+			assert.Equal(t, codes.ResourceExhausted, status.Code(e))
+			assert.NotEmpty(t, trailer.Get(conventions.RetryPushbackHeader))
+
+			_, e = call("client-b")
+			assert.NoError(t, e)
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rejected))
+	families, e := reg.Gather()
+	if !assert.NoError(t, e) {
+		return
+	}
+	var limited float64
+	for _, f := range families {
+		if f.GetName() == "sbr_grpc_server_methods_rate_limited" {
+			for _, m := range f.GetMetric() {
+				limited += m.GetCounter().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(1), limited)
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thataway/common-lib/logger"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_RBAC(t *testing.T) {
+	ep, err := pkgNet.ParseEndpoint("127.0.0.1:7204")
+	if !assert.NoError(t, err) {
+		return
+	}
+	logger.SetLevel(zap.InfoLevel)
+	buf := new(lockedBuffer)
+	logger.SetLogger(logger.NewWithSink(zap.InfoLevel, buf))
+
+	var dir string
+	if dir, err = ioutil.TempDir("", "rbac"); !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	policyFile := filepath.Join(dir, "policy.yaml")
+	const yamlPolicy = `
+default: deny
+rules:
+  - methods: ["strlib.v1.*"]
+    roles: ["reader"]
+  - methods: ["/strlib.v1.strlib/Uppercase"]
+    roles: ["writer"]
+`
+	if err = ioutil.WriteFile(policyFile, []byte(yamlPolicy), 0600); !assert.NoError(t, err) {
+		return
+	}
+	var (
+		auth *interceptors.Authenticator
+		rbac *interceptors.RBAC
+	)
+	auth, err = interceptors.NewAuthenticator(
+		interceptors.AuthWithVerifiers(interceptors.NewAPIKeyVerifier(map[string]interceptors.Principal{
+			"reader-key": {Name: "reader", Roles: []string{"reader"}},
+			"writer-key": {Name: "writer", Roles: []string{"writer"}},
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rbac, err = interceptors.NewRBAC(
+		interceptors.RBACWithPolicyFile(policyFile),
+		interceptors.RBACWithReloadInterval(20*time.Millisecond),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bone := &fishBone{endPt: ep}
+	bone.v.Store(func(_ context.Context, q *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) { //nolint:unparam
+		return &strlib.UppercaseResponse{Value: q.GetValue()}, nil
+	})
+	bone.serverOptions = []server.APIServerOption{
+		server.WithUnaryInterceptors(auth.Unary, rbac.Unary),
+		server.WithStreamInterceptors(auth.Stream, rbac.Stream),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var srv *server.APIServer
+	if srv, err = bone.newServer(); !assert.NoError(t, err) {
+		return
+	}
+	runners := []func() error{
+		func() error {
+			e := srv.Run(ctx, bone.endPt)
+			assert.NoError(t, e)
+			return e
+		},
+		func() error {
+			return rbac.Watch(ctx)
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, bone.endPt.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			call := func(apiKey string) codes.Code {
+				c := metadata.AppendToOutgoingContext(ctx, conventions.APIKeyHeader, apiKey)
+				_, e1 := client.Uppercase(c, &strlib.UppercaseQuery{Value: "abc"})
+				return status.Code(e1)
+			}
+			//the most specific rule wins
+			assert.Equal(t, codes.OK, call("writer-key"))
+			assert.Equal(t, codes.PermissionDenied, call("reader-key"))
+
+			const jsonPolicy = `{"default": "deny", "rules": [{"methods": ["/strlib.v1.strlib/*"], "roles": ["reader"]}]}`
+			if e = ioutil.WriteFile(policyFile, []byte(jsonPolicy), 0600); !assert.NoError(t, e) {
+				return e
+			}
+			for i := 0; i < 100 && call("reader-key") != codes.OK; i++ {
+				time.Sleep(20 * time.Millisecond)
+			}
+			assert.Equal(t, codes.OK, call("reader-key"))
+			assert.Equal(t, codes.PermissionDenied, call("writer-key"))
+
+			//health check is served despite deny by default
+			_, e = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			assert.NoError(t, e)
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+	_ = logger.Global().Sync()
+	audit := buf.String()
+	assert.True(t, strings.Contains(audit, "RBAC-AUDIT"))
+	assert.True(t, strings.Contains(audit, `"principal": "reader"`) || strings.Contains(audit, `"principal":"reader"`))
+	assert.True(t, strings.Contains(audit, "/strlib.v1.strlib/Uppercase"))
+}
+
+func Test_RBACSkipMethods(t *testing.T) {
+	handler := func(_ context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	rbac, err := interceptors.NewRBAC()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = rbac.Unary(context.Background(), nil, info, handler)
+	assert.NoError(t, err)
+
+	if rbac, err = interceptors.NewRBAC(interceptors.RBACSkipMethods()); !assert.NoError(t, err) {
+		return
+	}
+	_, err = rbac.Unary(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+//lockedBuffer log sink is written by server goroutines and read by test
+type lockedBuffer struct {
+	mx  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.String()
+}
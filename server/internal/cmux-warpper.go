@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"crypto/tls"
+	"net"
 	"sync"
 
 	"github.com/soheilhy/cmux"
@@ -9,13 +11,22 @@ import (
 
 // NewCMux anew CMux and wrap it
 func NewCMux(endpoint *netPkg.Endpoint) (cmux.CMux, error) {
+	return NewCMuxTLS(endpoint, nil)
+}
+
+// NewCMuxTLS anew CMux over TLS listener and wrap it; if 'conf' is nil it acts like NewCMux
+func NewCMuxTLS(endpoint *netPkg.Endpoint, conf *tls.Config) (cmux.CMux, error) {
 	l, e := netPkg.Listen(endpoint)
 	if e != nil {
 		return nil, e
 	}
 	var once sync.Once
+	var muxListener net.Listener = NoCloseListener{Listener: l}
+	if conf != nil {
+		muxListener = tls.NewListener(muxListener, conf)
+	}
 	return &cMuxWrapper{
-		CMux: cmux.New(NoCloseListener{Listener: l}),
+		CMux: cmux.New(muxListener),
 		closeNativeListener: func() {
 			once.Do(func() {
 				_ = l.Close()
@@ -26,6 +37,7 @@ func NewCMux(endpoint *netPkg.Endpoint) (cmux.CMux, error) {
 
 var (
 	_           = NewCMux
+	_           = NewCMuxTLS
 	_ cmux.CMux = (*cMuxWrapper)(nil)
 )
 
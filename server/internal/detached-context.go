@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"context"
+	"time"
+)
+
+//DetachedContext keeps values of parent context but is never cancelled with parent
+func DetachedContext(parent context.Context) context.Context {
+	return detachedContext{parent: parent}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
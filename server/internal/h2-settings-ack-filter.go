@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"net"
+
+	"golang.org/x/net/http2"
+)
+
+//NewSettingsAckFilterListener wraps listener gets HTTP/2 conns are rejected by cmux HTTP2 'SendSettings' matchers;
+//such matcher has sent its own SETTINGS to client so client ACKs them - these ACKs are dropped here
+//because the real HTTP/2 server never sent these SETTINGS and treats their ACKs as protocol error
+func NewSettingsAckFilterListener(l net.Listener) net.Listener {
+	return settingsAckFilterListener{Listener: l}
+}
+
+type (
+	settingsAckFilterListener struct {
+		net.Listener
+	}
+
+	settingsAckFilterConn struct {
+		net.Conn
+		in          []byte
+		out         []byte
+		stage       int
+		pendingAcks int
+		headersDone bool
+	}
+)
+
+const (
+	ackFilterStagePreface = iota
+	ackFilterStageFrames
+	ackFilterStagePassThrough
+)
+
+const http2FrameHeaderLen = 9
+
+//Accept impl net.Listener
+func (l settingsAckFilterListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &settingsAckFilterConn{Conn: c}, nil
+}
+
+//Read impl net.Conn
+func (c *settingsAckFilterConn) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.stage == ackFilterStagePassThrough && len(c.in) == 0 {
+			return c.Conn.Read(p)
+		}
+		var buf [4096]byte
+		n, err := c.Conn.Read(buf[:])
+		c.in = append(c.in, buf[:n]...)
+		c.process()
+		if err != nil && len(c.out) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+func (c *settingsAckFilterConn) process() {
+	if c.stage == ackFilterStagePreface {
+		n := len(c.in)
+		if n > len(http2.ClientPreface) {
+			n = len(http2.ClientPreface)
+		}
+		switch {
+		case string(c.in[:n]) != http2.ClientPreface[:n]:
+			c.stage = ackFilterStagePassThrough
+		case n == len(http2.ClientPreface):
+			c.out, c.in = append(c.out, c.in[:n]...), c.in[n:]
+			c.stage = ackFilterStageFrames
+		default:
+			return
+		}
+	}
+	for c.stage == ackFilterStageFrames && len(c.in) >= http2FrameHeaderLen {
+		h := c.in[:http2FrameHeaderLen]
+		size := http2FrameHeaderLen + (int(h[0])<<16 | int(h[1])<<8 | int(h[2]))
+		if len(c.in) < size {
+			return
+		}
+		typ, flags := http2.FrameType(h[3]), http2.Flags(h[4])
+		drop := false
+		switch typ {
+		case http2.FrameSettings:
+			if flags.Has(http2.FlagSettingsAck) {
+				if drop = c.pendingAcks > 0; drop {
+					c.pendingAcks--
+				}
+			} else if !c.headersDone {
+				c.pendingAcks++ //cmux has answered them with its SETTINGS
+			}
+		case http2.FrameHeaders, http2.FrameContinuation:
+			c.headersDone = c.headersDone || flags.Has(http2.FlagHeadersEndHeaders)
+		}
+		if !drop {
+			c.out = append(c.out, c.in[:size]...)
+		}
+		c.in = c.in[size:]
+		if c.headersDone && c.pendingAcks == 0 {
+			c.stage = ackFilterStagePassThrough
+		}
+	}
+	if c.stage == ackFilterStagePassThrough {
+		c.out, c.in = append(c.out, c.in...), nil
+	}
+}
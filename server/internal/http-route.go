@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type (
+	httpRouteCtxKey struct{}
+
+	//httpRoute holds route template of request is known by handler deeper in chain, e.g. by gateway
+	httpRoute struct {
+		pattern atomic.Value
+	}
+)
+
+//WithHTTPRouteSlot makes context where SetHTTPRoute can note route template of request
+func WithHTTPRouteSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, httpRouteCtxKey{}, new(httpRoute))
+}
+
+//SetHTTPRoute notes route template of request if context has slot for it
+func SetHTTPRoute(ctx context.Context, pattern string) {
+	if r, _ := ctx.Value(httpRouteCtxKey{}).(*httpRoute); r != nil && len(pattern) > 0 {
+		r.pattern.Store(pattern)
+	}
+}
+
+//HTTPRouteFromContext gives route template is noted by SetHTTPRoute
+func HTTPRouteFromContext(ctx context.Context) (string, bool) {
+	if r, _ := ctx.Value(httpRouteCtxKey{}).(*httpRoute); r != nil {
+		s, ok := r.pattern.Load().(string)
+		return s, ok
+	}
+	return "", false
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"google.golang.org/grpc"
+)
+
+//ServerStreamHooks are called after stream message is sent or received; nil hook is skipped
+type ServerStreamHooks struct {
+	OnSend func(m interface{}, err error)
+	OnRecv func(m interface{}, err error)
+}
+
+//ServerStreamWithHooks override ServerStream SendMsg and RecvMsg with hooks
+func ServerStreamWithHooks(s grpc.ServerStream, hooks ServerStreamHooks) grpc.ServerStream {
+	return &serverStreamWithHooks{
+		ServerStream: s,
+		hooks:        hooks,
+	}
+}
+
+type serverStreamWithHooks struct {
+	grpc.ServerStream
+	hooks ServerStreamHooks
+}
+
+func (ss *serverStreamWithHooks) SendMsg(m interface{}) error {
+	err := ss.ServerStream.SendMsg(m)
+	if h := ss.hooks.OnSend; h != nil {
+		h(m, err)
+	}
+	return err
+}
+
+func (ss *serverStreamWithHooks) RecvMsg(m interface{}) error {
+	err := ss.ServerStream.RecvMsg(m)
+	if h := ss.hooks.OnRecv; h != nil {
+		h(m, err)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc/credentials"
+)
+
+//NewTerminatedTLSCreds server transport credentials for connections TLS is terminated on listener;
+//they do no handshake but give TLS state of connection to peer info
+func NewTerminatedTLSCreds() credentials.TransportCredentials {
+	return terminatedTLSCreds{}
+}
+
+//TLSConnOf gets TLS connection under cmux (and our wrapped) connection
+func TLSConnOf(c net.Conn) (*tls.Conn, bool) {
+	for c != nil {
+		switch t := c.(type) {
+		case *tls.Conn:
+			return t, true
+		case *cmux.MuxConn:
+			c = t.Conn
+		case *settingsAckFilterConn:
+			c = t.Conn
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+type terminatedTLSCreds struct{}
+
+var _ credentials.TransportCredentials = terminatedTLSCreds{}
+
+//ClientHandshake impl credentials.TransportCredentials
+func (terminatedTLSCreds) ClientHandshake(_ context.Context, _ string, _ net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("terminated TLS credentials are for server side only")
+}
+
+//ServerHandshake impl credentials.TransportCredentials
+func (terminatedTLSCreds) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tc, ok := TLSConnOf(c)
+	if !ok {
+		return c, nil, nil
+	}
+	info := credentials.TLSInfo{
+		State: tc.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{
+			SecurityLevel: credentials.PrivacyAndIntegrity,
+		},
+	}
+	return c, info, nil
+}
+
+//Info impl credentials.TransportCredentials
+func (terminatedTLSCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+	}
+}
+
+//Clone impl credentials.TransportCredentials
+func (c terminatedTLSCreds) Clone() credentials.TransportCredentials {
+	return c
+}
+
+//OverrideServerName impl credentials.TransportCredentials
+func (terminatedTLSCreds) OverrideServerName(_ string) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/server/interceptors"
+)
+
+type authFailedMetric struct {
+	methodAuthFailed *prometheus.CounterVec
+}
+
+func newAuthFailedMetric(options serverMetricsOptions) prometheus.Collector {
+	return &authFailedMetric{
+		methodAuthFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_auth_failed",
+			Help:        "not authenticated methods counter",
+		}, []string{LabelService, LabelMethod, LabelReason}),
+	}
+}
+
+func (met *authFailedMetric) Describe(c chan<- *prometheus.Desc) {
+	met.methodAuthFailed.Describe(c)
+}
+
+func (met *authFailedMetric) Collect(c chan<- prometheus.Metric) {
+	met.methodAuthFailed.Collect(c)
+}
+
+func (met *authFailedMetric) observeAuthFailed(event interceptors.OnAuthFailedEvent) {
+	labs := prometheus.Labels{
+		LabelService: event.Info.ServiceFQN,
+		LabelMethod:  event.Info.Method,
+		LabelReason:  event.Reason,
+	}
+	met.methodAuthFailed.With(labs).Inc()
+}
@@ -0,0 +1,52 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/server/interceptors"
+)
+
+type concurrencyLimitMetric struct {
+	limiter *interceptors.ConcurrencyLimiter
+	limit   *prometheus.Desc
+	shed    *prometheus.Desc
+}
+
+//global limit has no service and method
+const allServicesAndMethods = "*"
+
+func newConcurrencyLimitMetric(options serverMetricsOptions) prometheus.Collector {
+	labels := []string{LabelService, LabelMethod}
+	return &concurrencyLimitMetric{
+		limiter: options.ConcurrencyLimiter,
+		limit: prometheus.NewDesc(
+			prometheus.BuildFQName(options.Namespace, options.Subsystem, "concurrency_limit"),
+			"current limit of in-flight methods", labels, options.ConstLabels),
+		shed: prometheus.NewDesc(
+			prometheus.BuildFQName(options.Namespace, options.Subsystem, "methods_shed"),
+			"shed by concurrency limiter methods counter", labels, options.ConstLabels),
+	}
+}
+
+func (met *concurrencyLimitMetric) Describe(c chan<- *prometheus.Desc) {
+	if met.limiter != nil {
+		for _, d := range []*prometheus.Desc{met.limit, met.shed} {
+			c <- d
+		}
+	}
+}
+
+func (met *concurrencyLimitMetric) Collect(c chan<- prometheus.Metric) {
+	if met.limiter == nil {
+		return
+	}
+	for _, st := range met.limiter.Stats() {
+		service, method := st.Service, st.Method
+		if len(service) == 0 {
+			service, method = allServicesAndMethods, allServicesAndMethods
+		}
+		c <- prometheus.MustNewConstMetric(met.shed, prometheus.CounterValue, float64(st.Shed), service, method)
+		if st.Limit > 0 {
+			c <- prometheus.MustNewConstMetric(met.limit, prometheus.GaugeValue, float64(st.Limit), service, method)
+		}
+	}
+}
@@ -11,10 +11,11 @@ import (
 
 func newConnectionsCountMetric(options serverMetricsOptions) prometheus.Collector {
 	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "connections",
-		Help:      "connection count at moment on a server",
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        "connections",
+		Help:        "connection count at moment on a server",
 	}, []string{LabelLocalAddr})
 	return &connMetric{GaugeVec: vec}
 }
@@ -0,0 +1,113 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/server/interceptors"
+	"google.golang.org/grpc/stats"
+)
+
+type (
+	inFlightMetric struct {
+		interceptors.StatsHandlerBase
+		inFlight       *prometheus.GaugeVec
+		streamDuration *prometheus.HistogramVec
+		options        serverMetricsOptions
+	}
+
+	inFlightCtxKey struct{}
+
+	//inFlightState per RPC; End is counted only if Begin is counted
+	inFlightState struct {
+		begun     int32
+		streaming bool
+	}
+)
+
+var _ stats.Handler = (*inFlightMetric)(nil)
+
+func newInFlightMetric(options serverMetricsOptions) prometheus.Collector {
+	help, buckets := "streaming methods duration in milliseconds",
+		[]float64{10, 100, 500, 1000, 5000, 10000, 30000, 60000, 300000, 600000, 1800000, 3600000}
+	if options.NativeUnits {
+		help, buckets = "streaming methods duration in seconds",
+			[]float64{.01, .1, .5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+	}
+	return &inFlightMetric{
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_in_flight",
+			Help:        "methods are running at moment",
+		}, []string{LabelService, LabelMethod}),
+		streamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("stream_duration", "seconds"),
+			Help:        help,
+			Buckets:     buckets,
+		}, []string{LabelService, LabelMethod, LabelGRPCCode}),
+		options: options,
+	}
+}
+
+func (met *inFlightMetric) Describe(c chan<- *prometheus.Desc) {
+	met.inFlight.Describe(c)
+	met.streamDuration.Describe(c)
+}
+
+func (met *inFlightMetric) Collect(c chan<- prometheus.Metric) {
+	met.inFlight.Collect(c)
+	met.streamDuration.Collect(c)
+}
+
+//TagRPC ...
+func (met *inFlightMetric) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, inFlightCtxKey{}, new(inFlightState))
+}
+
+//HandleRPC ...
+func (met *inFlightMetric) HandleRPC(ctx context.Context, stat stats.RPCStats) {
+	if stat.IsClient() {
+		return
+	}
+	state, _ := ctx.Value(inFlightCtxKey{}).(*inFlightState)
+	if state == nil {
+		return
+	}
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		return
+	}
+	labs := prometheus.Labels{
+		LabelService: mi.ServiceFQN,
+		LabelMethod:  mi.Method,
+	}
+	switch t := stat.(type) {
+	case *stats.Begin:
+		if atomic.CompareAndSwapInt32(&state.begun, 0, 1) {
+			state.streaming = t.IsClientStream || t.IsServerStream
+			met.inFlight.With(labs).Inc()
+		}
+	case *stats.End:
+		if !atomic.CompareAndSwapInt32(&state.begun, 1, 0) {
+			return
+		}
+		met.inFlight.With(labs).Dec()
+		if state.streaming {
+			unit := time.Millisecond
+			if met.options.NativeUnits {
+				unit = time.Second
+			}
+			labs[LabelGRPCCode] = finishedCode(ctx, t.Error).String()
+			d := float64(t.EndTime.Sub(t.BeginTime)) / float64(unit)
+			met.options.observe(ctx, met.streamDuration.With(labs), d)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package prometheus_metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/server/interceptors"
+	"google.golang.org/grpc/stats"
+)
+
+type payloadSizeHistograms struct {
+	interceptors.StatsHandlerBase
+	reqSize      *prometheus.HistogramVec
+	reqWireSize  *prometheus.HistogramVec
+	respSize     *prometheus.HistogramVec
+	respWireSize *prometheus.HistogramVec
+	options      serverMetricsOptions
+}
+
+var _ stats.Handler = (*payloadSizeHistograms)(nil)
+
+//DefaultPayloadSizeBuckets buckets of payload size histograms: 64B ... 16MB
+var DefaultPayloadSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+func newPayloadSizeHistograms(options serverMetricsOptions) prometheus.Collector {
+	buckets := options.PayloadSizeBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultPayloadSizeBuckets
+	}
+	mk := func(name, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName(name, "bytes"),
+			Help:        help,
+			Buckets:     buckets,
+		}, []string{LabelService, LabelMethod})
+	}
+	return &payloadSizeHistograms{
+		reqSize:      mk("request_size", "uncompressed size in bytes of request messages"),
+		reqWireSize:  mk("request_wire_size", "wire size in bytes of request messages"),
+		respSize:     mk("response_size", "uncompressed size in bytes of response messages"),
+		respWireSize: mk("response_wire_size", "wire size in bytes of response messages"),
+		options:      options,
+	}
+}
+
+func (met *payloadSizeHistograms) collectors() []prometheus.Collector {
+	return []prometheus.Collector{met.reqSize, met.reqWireSize, met.respSize, met.respWireSize}
+}
+
+func (met *payloadSizeHistograms) Describe(c chan<- *prometheus.Desc) {
+	for _, coll := range met.collectors() {
+		coll.Describe(c)
+	}
+}
+
+func (met *payloadSizeHistograms) Collect(c chan<- prometheus.Metric) {
+	for _, coll := range met.collectors() {
+		coll.Collect(c)
+	}
+}
+
+//HandleRPC ...
+func (met *payloadSizeHistograms) HandleRPC(ctx context.Context, stat stats.RPCStats) {
+	if stat.IsClient() {
+		return
+	}
+	var size, wireSize *prometheus.HistogramVec
+	var length, wireLength int
+	switch t := stat.(type) {
+	case *stats.InPayload:
+		size, wireSize, length, wireLength = met.reqSize, met.reqWireSize, t.Length, t.WireLength
+	case *stats.OutPayload:
+		size, wireSize, length, wireLength = met.respSize, met.respWireSize, t.Length, t.WireLength
+	default:
+		return
+	}
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		return
+	}
+	labs := prometheus.Labels{
+		LabelService: mi.ServiceFQN,
+		LabelMethod:  mi.Method,
+	}
+	met.options.observe(ctx, size.With(labs), float64(length))
+	met.options.observe(ctx, wireSize.With(labs), float64(wireLength))
+}
@@ -0,0 +1,40 @@
+package prometheus_metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/server/interceptors"
+)
+
+type rateLimitedMetric struct {
+	methodRateLimited *prometheus.CounterVec
+	options           serverMetricsOptions
+}
+
+func newRateLimitedMetric(options serverMetricsOptions) prometheus.Collector {
+	return &rateLimitedMetric{
+		methodRateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "methods_rate_limited",
+			Help:        "rejected by rate limiter methods counter",
+		}, options.withClientName(LabelService, LabelMethod)),
+		options: options,
+	}
+}
+
+func (met *rateLimitedMetric) Describe(c chan<- *prometheus.Desc) {
+	met.methodRateLimited.Describe(c)
+}
+
+func (met *rateLimitedMetric) Collect(c chan<- prometheus.Metric) {
+	met.methodRateLimited.Collect(c)
+}
+
+func (met *rateLimitedMetric) observeRateLimited(event interceptors.OnRateLimitedEvent) {
+	labs := prometheus.Labels{
+		LabelService: event.Info.ServiceFQN,
+		LabelMethod:  event.Info.Method,
+	}
+	met.methodRateLimited.With(met.options.setClientName(event.Ctx, labs)).Inc()
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thataway/common-lib/pkg/conventions"
 	"github.com/thataway/common-lib/server/interceptors"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
 )
@@ -16,44 +17,50 @@ type totalRequestsMetric struct {
 	methodStarted  *prometheus.CounterVec
 	methodFinished *prometheus.CounterVec
 	methodPanicked *prometheus.CounterVec
+	options        serverMetricsOptions
 }
 
 var _ stats.Handler = (*totalRequestsMetric)(nil)
 
 func newTotalRequestsMetrics(options serverMetricsOptions) prometheus.Collector {
 	messages := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "messages",
-		Help:      "received and sent message counters",
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        "messages",
+		Help:        "received and sent message counters",
 	}, []string{LabelService, LabelMethod, LabelState})
 
 	started := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "methods_started",
-		Help:      "started methods counter",
-	}, []string{LabelService, LabelMethod, LabelClientName})
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        "methods_started",
+		Help:        "started methods counter",
+	}, options.withClientName(LabelService, LabelMethod))
 
 	finished := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "methods_finished",
-		Help:      "finished methods counter",
-	}, []string{LabelService, LabelMethod, LabelClientName, LabelGRPCCode})
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        "methods_finished",
+		Help:        "finished methods counter",
+	}, options.withClientName(LabelService, LabelMethod, LabelGRPCCode))
 
 	panicked := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "methods_panicked",
-		Help:      "panicked methods counter",
-	}, []string{LabelService, LabelMethod, LabelClientName})
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        "methods_panicked",
+		Help:        "panicked methods counter",
+	}, options.withClientName(LabelService, LabelMethod))
 
 	return &totalRequestsMetric{
 		messages:       messages,
 		methodStarted:  started,
 		methodFinished: finished,
 		methodPanicked: panicked,
+		options:        options,
 	}
 }
 
@@ -88,11 +95,11 @@ func (met *totalRequestsMetric) HandleRPC(ctx context.Context, stat stats.RPCSta
 	var vec *prometheus.CounterVec
 	switch t := stat.(type) {
 	case *stats.Begin:
-		labs[LabelClientName] = conventions.ClientName.Incoming(ctx, "unknown")
+		met.options.setClientName(ctx, labs)
 		vec = met.methodStarted
 	case *stats.End:
-		labs[LabelClientName] = conventions.ClientName.Incoming(ctx, "unknown")
-		labs[LabelGRPCCode] = status.Code(t.Error).String()
+		met.options.setClientName(ctx, labs)
+		labs[LabelGRPCCode] = finishedCode(ctx, t.Error).String()
 		vec = met.methodFinished
 	case *stats.InPayload:
 		labs[LabelState] = Received
@@ -106,11 +113,19 @@ func (met *totalRequestsMetric) HandleRPC(ctx context.Context, stat stats.RPCSta
 	vec.With(labs).Inc()
 }
 
+//finishedCode call is out of deadline is counted as DeadlineExceeded whatever error handler returns
+func finishedCode(ctx context.Context, err error) codes.Code {
+	code := status.Code(err)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		code = codes.DeadlineExceeded
+	}
+	return code
+}
+
 func (met *totalRequestsMetric) observePanic(event interceptors.OnPanicEvent) {
 	labs := prometheus.Labels{
-		LabelService:    event.Info.ServiceFQN,
-		LabelMethod:     event.Info.Method,
-		LabelClientName: conventions.ClientName.Incoming(event.Ctx, "unknown"),
+		LabelService: event.Info.ServiceFQN,
+		LabelMethod:  event.Info.Method,
 	}
-	met.methodPanicked.With(labs).Inc()
+	met.methodPanicked.With(met.options.setClientName(event.Ctx, labs)).Inc()
 }
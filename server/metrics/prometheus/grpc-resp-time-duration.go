@@ -11,13 +11,21 @@ import (
 )
 
 func newResponseTimeHistogram(options serverMetricsOptions) prometheus.Collector {
-	res := new(responseTimeHistogram)
+	res := &responseTimeHistogram{options: options}
+	help, buckets := "response time duration in milliseconds", res.defaultBucket()
+	if options.NativeUnits {
+		help, buckets = "response time duration in seconds", prometheus.DefBuckets
+	}
+	if len(options.ResponseTimeBuckets) > 0 {
+		buckets = options.ResponseTimeBuckets
+	}
 	hist := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "response_time",
-		Help:      "response time duration in milliseconds",
-		Buckets:   res.defaultBucket(),
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		ConstLabels: options.ConstLabels,
+		Name:        options.unitName("response_time", "seconds"),
+		Help:        help,
+		Buckets:     buckets,
 	}, []string{LabelService, LabelMethod})
 	res.HistogramVec = hist
 	return res
@@ -26,10 +34,17 @@ func newResponseTimeHistogram(options serverMetricsOptions) prometheus.Collector
 type responseTimeHistogram struct {
 	interceptors.StatsHandlerBase
 	*prometheus.HistogramVec
+	options serverMetricsOptions
 }
 
 var _ stats.Handler = (*responseTimeHistogram)(nil)
 
+//FineResponseTimeBuckets response time buckets in milliseconds with 1 ... 7.5 ms steps are missed in default ones;
+//they are opt-in by WithResponseTimeBuckets(FineResponseTimeBuckets...)
+var FineResponseTimeBuckets = []float64{
+	.0001, .0005, .00075, .001, .0025, .005, 0.0075, .01, 0.025, .05, 0.075,
+	.1, .25, .5, .75, 1, 2.5, 5, 7.5, 10, 25, 50, 75, 100, 500, 1000}
+
 func (met *responseTimeHistogram) defaultBucket() []float64 {
 	return []float64{
 		.0001, .0005, .00075, .001, .0025, .005, 0.0075, .01, 0.025, .05, 0.075,
@@ -49,7 +64,11 @@ func (met *responseTimeHistogram) HandleRPC(ctx context.Context, stat stats.RPCS
 			LabelMethod:  mi.Method,
 			LabelService: mi.ServiceFQN,
 		}
-		milliseconds := float64(end.EndTime.Sub(end.BeginTime)) / float64(time.Millisecond)
-		met.With(labs).Observe(milliseconds)
+		unit := time.Millisecond
+		if met.options.NativeUnits {
+			unit = time.Second
+		}
+		d := float64(end.EndTime.Sub(end.BeginTime)) / float64(unit)
+		met.options.observe(ctx, met.With(labs), d)
 	}
 }
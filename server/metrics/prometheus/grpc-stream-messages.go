@@ -0,0 +1,145 @@
+package prometheus_metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/pkg/conventions"
+	"github.com/thataway/common-lib/server/interceptors"
+	"google.golang.org/grpc/stats"
+)
+
+type (
+	//streamMessagesMetric per message stream metrics; debug log of each message is written
+	//by interceptors.APILogger with option interceptors.APILogStreamMessages
+	streamMessagesMetric struct {
+		interceptors.StatsHandlerBase
+		messages  *prometheus.HistogramVec
+		sizes     *prometheus.HistogramVec
+		intervals *prometheus.HistogramVec
+		options   serverMetricsOptions
+	}
+
+	streamMessagesCtxKey struct{}
+
+	//streamMessagesState per RPC counters; index 0 is for received and 1 is for sent messages
+	streamMessagesState struct {
+		mx        sync.Mutex
+		streaming bool
+		counts    [2]int
+		last      [2]time.Time
+	}
+)
+
+var _ stats.Handler = (*streamMessagesMetric)(nil)
+
+func newStreamMessagesMetric(options serverMetricsOptions) prometheus.Collector {
+	labels := []string{LabelService, LabelMethod, LabelState}
+	intervalHelp, intervalBuckets := "time between stream messages received and sent in milliseconds",
+		[]float64{1, 5, 10, 50, 100, 500, 1000, 5000, 10000, 60000, 300000}
+	if options.NativeUnits {
+		intervalHelp, intervalBuckets = "time between stream messages received and sent in seconds",
+			[]float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 60, 300}
+	}
+	return &streamMessagesMetric{
+		messages: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "stream_messages",
+			Help:        "count of messages received and sent per stream",
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 10),
+		}, labels),
+		sizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("stream_message_size", "bytes"),
+			Help:        "size in bytes of stream messages received and sent",
+			Buckets:     prometheus.ExponentialBuckets(64, 4, 10),
+		}, labels),
+		intervals: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("stream_message_interval", "seconds"),
+			Help:        intervalHelp,
+			Buckets:     intervalBuckets,
+		}, labels),
+		options: options,
+	}
+}
+
+func (met *streamMessagesMetric) Describe(c chan<- *prometheus.Desc) {
+	for _, coll := range []prometheus.Collector{met.messages, met.sizes, met.intervals} {
+		coll.Describe(c)
+	}
+}
+
+func (met *streamMessagesMetric) Collect(c chan<- prometheus.Metric) {
+	for _, coll := range []prometheus.Collector{met.messages, met.sizes, met.intervals} {
+		coll.Collect(c)
+	}
+}
+
+//TagRPC ...
+func (met *streamMessagesMetric) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, streamMessagesCtxKey{}, new(streamMessagesState))
+}
+
+//HandleRPC ...
+func (met *streamMessagesMetric) HandleRPC(ctx context.Context, stat stats.RPCStats) {
+	if stat.IsClient() {
+		return
+	}
+	state, _ := ctx.Value(streamMessagesCtxKey{}).(*streamMessagesState)
+	if state == nil {
+		return
+	}
+	if begin, ok := stat.(*stats.Begin); ok {
+		state.mx.Lock()
+		state.streaming = begin.IsClientStream || begin.IsServerStream
+		state.mx.Unlock()
+		return
+	}
+	var mi conventions.GrpcMethodInfo
+	if !mi.FromContext(ctx) {
+		return
+	}
+	labs := func(dir int) prometheus.Labels {
+		return prometheus.Labels{
+			LabelService: mi.ServiceFQN,
+			LabelMethod:  mi.Method,
+			LabelState:   [...]string{Received, Sent}[dir],
+		}
+	}
+	state.mx.Lock()
+	defer state.mx.Unlock()
+	if !state.streaming {
+		return
+	}
+	unit := time.Millisecond
+	if met.options.NativeUnits {
+		unit = time.Second
+	}
+	onMessage := func(dir, size int, at time.Time) {
+		state.counts[dir]++
+		met.options.observe(ctx, met.sizes.With(labs(dir)), float64(size))
+		if last := state.last[dir]; !last.IsZero() {
+			met.options.observe(ctx, met.intervals.With(labs(dir)), float64(at.Sub(last))/float64(unit))
+		}
+		state.last[dir] = at
+	}
+	switch t := stat.(type) {
+	case *stats.InPayload:
+		onMessage(0, t.Length, t.RecvTime)
+	case *stats.OutPayload:
+		onMessage(1, t.Length, t.SentTime)
+	case *stats.End:
+		for dir, n := range state.counts {
+			met.messages.With(labs(dir)).Observe(float64(n))
+		}
+	}
+}
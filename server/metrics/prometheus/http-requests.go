@@ -0,0 +1,199 @@
+package prometheus_metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/internal"
+)
+
+type (
+	httpRequestsMetric struct {
+		interceptors.StatsHandlerBase
+		requests     *prometheus.CounterVec
+		responseTime *prometheus.HistogramVec
+		requestSize  *prometheus.HistogramVec
+		responseSize *prometheus.HistogramVec
+		options      serverMetricsOptions
+	}
+
+	//httpResponseWriter counts bytes written and remembers status code
+	httpResponseWriter struct {
+		http.ResponseWriter
+		status  int
+		written int64
+	}
+
+	//httpRequestBody counts bytes read
+	httpRequestBody struct {
+		io.ReadCloser
+		read int64
+	}
+)
+
+//UnknownRoute route of request is not matched by any handler
+const UnknownRoute = "unknown"
+
+func newHTTPRequestsMetric(options serverMetricsOptions) prometheus.Collector {
+	labels := []string{LabelRoute, LabelHTTPMethod}
+	timeHelp, timeBuckets := "HTTP response time duration in milliseconds",
+		new(responseTimeHistogram).defaultBucket()
+	if options.NativeUnits {
+		timeHelp, timeBuckets = "HTTP response time duration in seconds", prometheus.DefBuckets
+	}
+	if len(options.ResponseTimeBuckets) > 0 {
+		timeBuckets = options.ResponseTimeBuckets
+	}
+	sizeBuckets := DefaultPayloadSizeBuckets
+	if len(options.PayloadSizeBuckets) > 0 {
+		sizeBuckets = options.PayloadSizeBuckets
+	}
+	return &httpRequestsMetric{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        "http_requests",
+			Help:        "HTTP requests counter",
+		}, append(labels, LabelStatusClass)),
+		responseTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("http_response_time", "seconds"),
+			Help:        timeHelp,
+			Buckets:     timeBuckets,
+		}, labels),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("http_request_size", "bytes"),
+			Help:        "size in bytes of HTTP request bodies",
+			Buckets:     sizeBuckets,
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   options.Namespace,
+			Subsystem:   options.Subsystem,
+			ConstLabels: options.ConstLabels,
+			Name:        options.unitName("http_response_size", "bytes"),
+			Help:        "size in bytes of HTTP response bodies",
+			Buckets:     sizeBuckets,
+		}, labels),
+		options: options,
+	}
+}
+
+func (met *httpRequestsMetric) Describe(c chan<- *prometheus.Desc) {
+	for _, coll := range []prometheus.Collector{met.requests, met.responseTime, met.requestSize, met.responseSize} {
+		coll.Describe(c)
+	}
+}
+
+func (met *httpRequestsMetric) Collect(c chan<- prometheus.Metric) {
+	for _, coll := range []prometheus.Collector{met.requests, met.responseTime, met.requestSize, met.responseSize} {
+		coll.Collect(c)
+	}
+}
+
+//HTTPMiddleware impl HTTP middleware; route label is template of gateway or chi route, never raw path
+func (met *httpRequestsMetric) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timePoint := time.Now()
+		ctx := internal.WithHTTPRouteSlot(r.Context())
+		rw := &httpResponseWriter{ResponseWriter: w}
+		body := &httpRequestBody{ReadCloser: r.Body}
+		r = r.WithContext(ctx)
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		next.ServeHTTP(rw, r)
+
+		labs := prometheus.Labels{
+			LabelRoute:      httpRouteOf(r),
+			LabelHTTPMethod: httpMethodOf(r),
+		}
+		unit := time.Millisecond
+		if met.options.NativeUnits {
+			unit = time.Second
+		}
+		met.options.observe(ctx, met.responseTime.With(labs), float64(time.Since(timePoint))/float64(unit))
+		met.options.observe(ctx, met.requestSize.With(labs), float64(atomic.LoadInt64(&body.read)))
+		met.options.observe(ctx, met.responseSize.With(labs), float64(atomic.LoadInt64(&rw.written)))
+		labs[LabelStatusClass] = statusClassOf(rw.statusCode())
+		met.requests.With(labs).Inc()
+	})
+}
+
+func httpRouteOf(r *http.Request) string {
+	if s, ok := internal.HTTPRouteFromContext(r.Context()); ok {
+		return s
+	}
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		if s := rc.RoutePattern(); len(s) > 0 {
+			return s
+		}
+	}
+	return UnknownRoute
+}
+
+func httpMethodOf(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return r.Method
+	}
+	return "OTHER"
+}
+
+func statusClassOf(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+func (w *httpResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+//WriteHeader impl http.ResponseWriter
+func (w *httpResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+//Write impl http.ResponseWriter
+func (w *httpResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(&w.written, int64(n))
+	return n, err
+}
+
+//Flush impl http.Flusher; gateway needs it for server streams
+func (w *httpResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Read impl io.Reader
+func (b *httpRequestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.read, int64(n))
+	return n, err
+}
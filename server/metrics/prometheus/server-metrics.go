@@ -1,8 +1,17 @@
 package prometheus_metrics
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/prometheus/client_golang/prometheus"
+	appIdentity "github.com/thataway/common-lib/app/identity"
+	otPriv "github.com/thataway/common-lib/internal/pkg/ot"
+	"github.com/thataway/common-lib/pkg/conventions"
 	"github.com/thataway/common-lib/server/interceptors"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
 )
 
 type (
@@ -12,14 +21,23 @@ type (
 	}
 
 	serverMetricsOptions struct {
-		Namespace string
-		Subsystem string
+		Namespace           string
+		Subsystem           string
+		ConcurrencyLimiter  *interceptors.ConcurrencyLimiter
+		PayloadSizeBuckets  []float64
+		ResponseTimeBuckets []float64
+		NativeUnits         bool
+		NoClientName        bool
+		ConstLabels         prometheus.Labels
+		Exemplars           bool
 	}
 
 	//ServerMetrics серверные метрики
 	ServerMetrics struct {
-		collectors     []prometheus.Collector
-		panicsObserver interceptors.OnPanicEventObserver
+		collectors         []prometheus.Collector
+		panicsObserver     interceptors.OnPanicEventObserver
+		rateLimitsObserver interceptors.OnRateLimitedEventObserver
+		authObserver       interceptors.OnAuthFailedEventObserver
 	}
 
 	serverMetricsOptionApplier func(*serverMetricsOptions)
@@ -27,16 +45,35 @@ type (
 	panicsObserver interface {
 		observePanic(interceptors.OnPanicEvent)
 	}
+
+	rateLimitsObserver interface {
+		observeRateLimited(interceptors.OnRateLimitedEvent)
+	}
+
+	authFailuresObserver interface {
+		observeAuthFailed(interceptors.OnAuthFailedEvent)
+	}
+
+	httpMiddleware interface {
+		HTTPMiddleware(next http.Handler) http.Handler
+	}
 )
 
 const ( //possible metrics labels
-	LabelLocalAddr  string = "local_address"  //nolint
-	LabelRemoteAddr        = "remote_address" //nolint
-	LabelClientName        = "client_name"    //nolint
-	LabelService           = "service"        //nolint
-	LabelMethod            = "method"         //nolint
-	LabelState             = "state"          //nolint
-	LabelGRPCCode          = "grpc_code"      //nolint
+	LabelLocalAddr   string = "local_address"  //nolint
+	LabelRemoteAddr         = "remote_address" //nolint
+	LabelClientName         = "client_name"    //nolint
+	LabelService            = "service"        //nolint
+	LabelMethod             = "method"         //nolint
+	LabelState              = "state"          //nolint
+	LabelGRPCCode           = "grpc_code"      //nolint
+	LabelReason             = "reason"         //nolint
+	LabelAppName            = "app_name"       //nolint
+	LabelAppVersion         = "app_version"    //nolint
+	LabelTraceID            = "trace_id"       //nolint
+	LabelRoute              = "route"          //nolint
+	LabelHTTPMethod         = "http_method"    //nolint
+	LabelStatusClass        = "status_class"   //nolint
 )
 
 const ( //label values
@@ -70,20 +107,45 @@ func NewMetrics(opts ...Option) *ServerMetrics {
 	collectors := append(ret.collectors,
 		newConnectionsCountMetric(options),
 		newTotalRequestsMetrics(options),
-		newResponseTimeHistogram(options))
+		newInFlightMetric(options),
+		newResponseTimeHistogram(options),
+		newStreamMessagesMetric(options),
+		newPayloadSizeHistograms(options),
+		newRateLimitedMetric(options),
+		newConcurrencyLimitMetric(options),
+		newAuthFailedMetric(options),
+		newHTTPRequestsMetric(options))
 	ret.collectors = collectors
 
 	var panicObservers []panicsObserver
+	var rateLimitObservers []rateLimitsObserver
+	var authObservers []authFailuresObserver
 	for _, coll := range collectors {
 		if obs, ok := coll.(panicsObserver); ok {
 			panicObservers = append(panicObservers, obs)
 		}
+		if obs, ok := coll.(rateLimitsObserver); ok {
+			rateLimitObservers = append(rateLimitObservers, obs)
+		}
+		if obs, ok := coll.(authFailuresObserver); ok {
+			authObservers = append(authObservers, obs)
+		}
 	}
 	ret.panicsObserver = func(event interceptors.OnPanicEvent) {
 		for _, o := range panicObservers {
 			o.observePanic(event)
 		}
 	}
+	ret.rateLimitsObserver = func(event interceptors.OnRateLimitedEvent) {
+		for _, o := range rateLimitObservers {
+			o.observeRateLimited(event)
+		}
+	}
+	ret.authObserver = func(event interceptors.OnAuthFailedEvent) {
+		for _, o := range authObservers {
+			o.observeAuthFailed(event)
+		}
+	}
 	return ret
 }
 
@@ -92,6 +154,26 @@ func (pMetrics *ServerMetrics) PanicsObserver() interceptors.OnPanicEventObserve
 	return pMetrics.panicsObserver
 }
 
+//RateLimitsObserver observer of calls rejected by interceptors.RateLimiter
+func (pMetrics *ServerMetrics) RateLimitsObserver() interceptors.OnRateLimitedEventObserver {
+	return pMetrics.rateLimitsObserver
+}
+
+//AuthFailuresObserver observer of callers are not authenticated by interceptors.Authenticator
+func (pMetrics *ServerMetrics) AuthFailuresObserver() interceptors.OnAuthFailedEventObserver {
+	return pMetrics.authObserver
+}
+
+//HTTPMiddleware HTTP middleware with metrics of HTTP requests; server adds it itself when it has StatHandlers
+func (pMetrics *ServerMetrics) HTTPMiddleware(next http.Handler) http.Handler {
+	for _, coll := range pMetrics.collectors {
+		if mw, _ := coll.(httpMiddleware); mw != nil {
+			next = mw.HTTPMiddleware(next)
+		}
+	}
+	return next
+}
+
 //StatHandlers ...
 func (pMetrics *ServerMetrics) StatHandlers() []interceptors.StatsHandler {
 	var ret []interceptors.StatsHandler
@@ -133,6 +215,133 @@ func WithSubsystem(ss string) Option {
 	return ret
 }
 
+//WithConcurrencyLimiter exports current limits and shed methods counts of limiter;
+//in-flight methods are exported by stats handler as methods_in_flight
+func WithConcurrencyLimiter(limiter *interceptors.ConcurrencyLimiter) Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.ConcurrencyLimiter = limiter
+	}
+	return ret
+}
+
+//WithPayloadSizeBuckets sets buckets of request and response size histograms instead of DefaultPayloadSizeBuckets
+func WithPayloadSizeBuckets(buckets ...float64) Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.PayloadSizeBuckets = append([]float64(nil), buckets...)
+	}
+	return ret
+}
+
+//WithResponseTimeBuckets sets buckets of response time histogram; they are in milliseconds or in seconds with WithNativeUnits
+func WithResponseTimeBuckets(buckets ...float64) Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.ResponseTimeBuckets = append([]float64(nil), buckets...)
+	}
+	return ret
+}
+
+//WithNativeUnits durations are in seconds and metric names have units suffixes like "response_time_seconds"
+//and "request_size_bytes" as Prometheus recommends
+func WithNativeUnits() Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.NativeUnits = true
+	}
+	return ret
+}
+
+//WithoutClientName drops high cardinality label client_name
+func WithoutClientName() Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.NoClientName = true
+	}
+	return ret
+}
+
+//WithConstLabels adds constant labels to all metrics
+func WithConstLabels(labels prometheus.Labels) Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		if options.ConstLabels == nil {
+			options.ConstLabels = make(prometheus.Labels)
+		}
+		for k, v := range labels {
+			options.ConstLabels[k] = v
+		}
+	}
+	return ret
+}
+
+//WithAppIdentityLabels adds constant labels app_name and app_version from app_identity
+func WithAppIdentityLabels() Option {
+	labels := make(prometheus.Labels)
+	if len(appIdentity.Name) > 0 {
+		labels[LabelAppName] = appIdentity.Name
+	}
+	if len(appIdentity.Version) > 0 {
+		labels[LabelAppVersion] = appIdentity.Version
+	}
+	return WithConstLabels(labels)
+}
+
+//WithExemplars histograms observations have exemplars with trace ID of incoming trace context;
+//exemplars are exposed in OpenMetrics format only, look at promhttp.HandlerOpts.EnableOpenMetrics
+func WithExemplars() Option {
+	var ret serverMetricsOptionApplier = func(options *serverMetricsOptions) {
+		options.Exemplars = true
+	}
+	return ret
+}
+
 func (f serverMetricsOptionApplier) apply(o *serverMetricsOptions) {
 	f(o)
 }
+
+//withClientName adds client_name label unless it is dropped
+func (o serverMetricsOptions) withClientName(labels ...string) []string {
+	if o.NoClientName {
+		return labels
+	}
+	return append(labels, LabelClientName)
+}
+
+//setClientName sets client_name label value unless it is dropped
+func (o serverMetricsOptions) setClientName(ctx context.Context, labs prometheus.Labels) prometheus.Labels {
+	if !o.NoClientName {
+		labs[LabelClientName] = conventions.ClientName.Incoming(ctx, "unknown")
+	}
+	return labs
+}
+
+//unitName adds unit suffix to name with WithNativeUnits
+func (o serverMetricsOptions) unitName(name, unit string) string {
+	if o.NativeUnits {
+		return name + "_" + unit
+	}
+	return name
+}
+
+//observe observes value with exemplar if they are enabled and incoming context has trace ID
+func (o serverMetricsOptions) observe(ctx context.Context, obs prometheus.Observer, v float64) {
+	if o.Exemplars {
+		if eo, ok := obs.(prometheus.ExemplarObserver); ok {
+			if traceID, ok1 := incomingTraceID(ctx); ok1 {
+				eo.ObserveWithExemplar(v, prometheus.Labels{LabelTraceID: traceID})
+				return
+			}
+		}
+	}
+	obs.Observe(v)
+}
+
+func incomingTraceID(ctx context.Context) (string, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		if md, _ := metadata.FromIncomingContext(ctx); md != nil {
+			ctx1 := propagation.TraceContext{}.Extract(ctx, otPriv.TextMapCarrierFromGrpcMD{MD: md})
+			sc = trace.SpanContextFromContext(ctx1)
+		}
+	}
+	if !sc.HasTraceID() {
+		return "", false
+	}
+	return sc.TraceID().String(), true
+}
@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/thataway/common-lib/pkg/conventions"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/health_check"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_DynamicServices(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7304")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(_ context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	serviceName := strlib.Strlib_ServiceDesc.ServiceName
+	var srv *server.APIServer
+	if srv, err = server.NewAPIServer(server.WithDynamicServices()); !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	uppercaseHTTP := func(v string) (int, string, error) {
+		data, e := json.Marshal(&strlib.UppercaseQuery{Value: v})
+		if e != nil {
+			return 0, "", e
+		}
+		var req *http.Request
+		req, e = http.NewRequestWithContext(ctx, http.MethodPost,
+			"http://"+endpoint.String()+"/v1/uppercase", bytes.NewBuffer(data))
+		if e != nil {
+			return 0, "", e
+		}
+		var resp *http.Response
+		if resp, e = http.DefaultClient.Do(req); e != nil {
+			return 0, "", e
+		}
+		defer resp.Body.Close() //nolint
+		var r strlib.UppercaseResponse
+		if resp.StatusCode == http.StatusOK {
+			e = json.NewDecoder(resp.Body).Decode(&r)
+		}
+		return resp.StatusCode, r.GetValue(), e
+	}
+	runners := []func() error{
+		func() error {
+			return srv.Run(ctx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := strlib.NewStrlibClient(conn)
+			hc := health_check.NewClient(conn)
+
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			assert.Equal(t, codes.Unimplemented, status.Code(e))
+			code, _, e := uppercaseHTTP("abc")
+			if assert.NoError(t, e) {
+				assert.Equal(t, http.StatusNotFound, code)
+			}
+
+			if e = srv.AddService(service); !assert.NoError(t, e) {
+				return e
+			}
+			assert.Error(t, srv.AddService(service))
+			var r *strlib.UppercaseResponse
+			if r, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"}); assert.NoError(t, e) {
+				assert.Equal(t, "ABC", r.GetValue())
+			}
+			var v string
+			if code, v, e = uppercaseHTTP("qwe"); assert.NoError(t, e) {
+				assert.Equal(t, http.StatusOK, code)
+				assert.Equal(t, "QWE", v)
+			}
+			var resp *health_check.Response
+			if resp, e = hc.Check(ctx, &health_check.Request{Service: serviceName}); assert.NoError(t, e) {
+				assert.Equal(t, health_check.StatusServing, resp.GetStatus())
+			}
+
+			if e = srv.EnableService(serviceName, false); !assert.NoError(t, e) {
+				return e
+			}
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			assert.Equal(t, codes.Unavailable, status.Code(e))
+			if resp, e = hc.Check(ctx, &health_check.Request{Service: serviceName}); assert.NoError(t, e) {
+				assert.Equal(t, health_check.StatusNotServing, resp.GetStatus())
+			}
+
+			if e = srv.RemoveService(serviceName); !assert.NoError(t, e) {
+				return e
+			}
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			assert.Equal(t, codes.Unimplemented, status.Code(e))
+			_, e = hc.Check(ctx, &health_check.Request{Service: serviceName})
+			assert.Equal(t, codes.NotFound, status.Code(e))
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
+
+func Test_DynamicServicesInterceptors(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7305")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(_ context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	var auth *interceptors.Authenticator
+	auth, err = interceptors.NewAuthenticator(
+		interceptors.AuthWithVerifiers(interceptors.NewAPIKeyVerifier(map[string]interceptors.Principal{
+			"secret-key": {Name: "robot"},
+		})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	uppercase := "/" + strlib.Strlib_ServiceDesc.ServiceName + "/Uppercase"
+	var unaryCalls, streamCalls int32
+	var srv *server.APIServer
+	srv, err = server.NewAPIServer(
+		server.WithDynamicServices(),
+		server.WithUnaryInterceptors(auth.Unary,
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if info.FullMethod == uppercase {
+					atomic.AddInt32(&unaryCalls, 1)
+				}
+				return handler(ctx, req)
+			}),
+		server.WithStreamInterceptors(auth.Stream,
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if info.FullMethod == uppercase {
+					atomic.AddInt32(&streamCalls, 1)
+				}
+				return handler(srv, ss)
+			}),
+		server.WithGatewayOptions(runtime.WithRoutingErrorHandler(
+			func(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, _ int) {
+				w.WriteHeader(http.StatusTeapot)
+			})),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	httpCall := func(path, apiKey string) (int, error) {
+		req, e := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+endpoint.String()+path,
+			strings.NewReader(`{"value":"abc"}`))
+		if e != nil {
+			return 0, e
+		}
+		req.Header.Set(conventions.APIKeyHeader, apiKey)
+		req.Close = true
+		resp, e := http.DefaultClient.Do(req)
+		if e != nil {
+			return 0, e
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	runners := []func() error{
+		func() error {
+			return srv.Run(ctx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			if e = srv.AddService(service); !assert.NoError(t, e) {
+				return e
+			}
+			client := strlib.NewStrlibClient(conn)
+			_, e = client.Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			assert.Equal(t, codes.Unauthenticated, status.Code(e))
+			authCtx := metadata.AppendToOutgoingContext(ctx, conventions.APIKeyHeader, "secret-key")
+			var r *strlib.UppercaseResponse
+			if r, e = client.Uppercase(authCtx, &strlib.UppercaseQuery{Value: "abc"}); assert.NoError(t, e) {
+				assert.Equal(t, "ABC", r.GetValue())
+			}
+			assert.Equal(t, int32(1), atomic.LoadInt32(&unaryCalls)) //first call is rejected by auth
+			assert.Equal(t, int32(0), atomic.LoadInt32(&streamCalls))
+
+			var code int
+			if code, e = httpCall("/v1/uppercase", ""); assert.NoError(t, e) {
+				assert.Equal(t, http.StatusUnauthorized, code)
+			}
+			if code, e = httpCall("/v1/uppercase", "secret-key"); assert.NoError(t, e) {
+				assert.Equal(t, http.StatusOK, code)
+			}
+			if code, e = httpCall("/v1/unknown", "secret-key"); assert.NoError(t, e) {
+				assert.Equal(t, http.StatusTeapot, code)
+			}
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/health_check"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type strLibWithProbe struct {
+	*StrLibImpl
+	probeStatus int32
+}
+
+//HealthProbe ...
+func (s *strLibWithProbe) HealthProbe(_ context.Context) (*health_check.Response, error) {
+	return &health_check.Response{
+		Status: health_check.ResponseStatus(atomic.LoadInt32(&s.probeStatus)),
+	}, nil
+}
+
+func Test_HealthWatch(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7301")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := &strLibWithProbe{
+		StrLibImpl:  new(StrLibImpl),
+		probeStatus: int32(health_check.StatusServing),
+	}
+	serviceName := strlib.Strlib_ServiceDesc.ServiceName
+	var srv *server.APIServer
+	srv, err = server.NewAPIServer(
+		server.WithServices(service),
+		server.WithHealthProbes(50*time.Millisecond, time.Second),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	runners := []func() error{
+		func() error {
+			return srv.Run(ctx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			client := health_check.NewClient(conn)
+
+			_, e = client.Check(ctx, &health_check.Request{Service: "unknown.Service"})
+			assert.Equal(t, codes.NotFound, status.Code(e))
+
+			var stream interface {
+				Recv() (*health_check.Response, error)
+			}
+			if stream, e = client.Watch(ctx, &health_check.Request{Service: serviceName}); !assert.NoError(t, e) {
+				return e
+			}
+			recv := func(expected health_check.ResponseStatus) bool {
+				for {
+					resp, e1 := stream.Recv()
+					if !assert.NoError(t, e1) {
+						return false
+					}
+					if resp.GetStatus() == expected {
+						return true
+					}
+				}
+			}
+			if !recv(health_check.StatusServing) {
+				return nil
+			}
+			atomic.StoreInt32(&service.probeStatus, int32(health_check.StatusNotServing))
+			if !recv(health_check.StatusNotServing) {
+				return nil
+			}
+			var resp *health_check.Response
+			resp, e = client.Check(ctx, &health_check.Request{})
+			if assert.NoError(t, e) {
+				assert.Equal(t, health_check.StatusNotServing, resp.GetStatus())
+			}
+			atomic.StoreInt32(&service.probeStatus, int32(health_check.StatusServing))
+			if !recv(health_check.StatusServing) {
+				return nil
+			}
+			resp, e = client.Check(ctx, &health_check.Request{})
+			if assert.NoError(t, e) {
+				assert.Equal(t, health_check.StatusServing, resp.GetStatus())
+			}
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+	st, _ := srv.HealthRegistry().ServingStatus(serviceName)
+	assert.Equal(t, health_check.StatusNotServing, st)
+}
+
+func Test_HTTPHealthEndpoints(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7302")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := &strLibWithProbe{
+		StrLibImpl:  new(StrLibImpl),
+		probeStatus: int32(health_check.StatusNotServing),
+	}
+	serviceName := strlib.Strlib_ServiceDesc.ServiceName
+	var srv *server.APIServer
+	srv, err = server.NewAPIServer(
+		server.WithServices(service),
+		server.WithHealthProbes(50*time.Millisecond, time.Second),
+		server.WithHTTPHealthEndpoints("", ""),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	type report struct {
+		Status   string            `json:"status"`
+		Services map[string]string `json:"services"`
+	}
+	get := func(path string) (int, report, error) {
+		var rep report
+		req, e := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+endpoint.String()+path, nil)
+		if e != nil {
+			return 0, rep, e
+		}
+		var resp *http.Response
+		if resp, e = http.DefaultClient.Do(req); e != nil {
+			return 0, rep, e
+		}
+		defer resp.Body.Close() //nolint
+		e = json.NewDecoder(resp.Body).Decode(&rep)
+		return resp.StatusCode, rep, e
+	}
+	runners := []func() error{
+		func() error {
+			return srv.Run(ctx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			var (
+				code int
+				rep  report
+				e    error
+			)
+			for i := 0; i < 100; i++ {
+				if code, rep, e = get(server.DefaultReadinessPath); e == nil && rep.Services[serviceName] == "NOT_SERVING" {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if !assert.NoError(t, e) {
+				return e
+			}
+			assert.Equal(t, http.StatusServiceUnavailable, code)
+			assert.Equal(t, "NOT_SERVING", rep.Status)
+			assert.Equal(t, "NOT_SERVING", rep.Services[serviceName])
+
+			code, rep, e = get(server.DefaultLivenessPath)
+			if assert.NoError(t, e) {
+				assert.Equal(t, http.StatusOK, code)
+			}
+			atomic.StoreInt32(&service.probeStatus, int32(health_check.StatusServing))
+			for i := 0; i < 100; i++ {
+				if code, rep, e = get(server.DefaultReadinessPath); e == nil && code == http.StatusOK {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if assert.NoError(t, e) {
+				assert.Equal(t, http.StatusOK, code)
+				assert.Equal(t, "SERVING", rep.Services[serviceName])
+			}
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
+
+func Test_DrainOnShutdown(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7303")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(_ context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	var srv *server.APIServer
+	if srv, err = server.NewAPIServer(server.WithServices(service)); !assert.NoError(t, err) {
+		return
+	}
+	var (
+		phasesMx sync.Mutex
+		phases   []server.DrainPhase
+	)
+	propagation := make(chan struct{})
+	onDrain := func(ev server.OnDrainEvent) {
+		phasesMx.Lock()
+		defer phasesMx.Unlock()
+		phases = append(phases, ev.Phase)
+		if ev.Phase == server.DrainPropagation {
+			close(propagation)
+		}
+	}
+	runCtx, stopServer := context.WithCancel(context.Background())
+	defer stopServer()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	runners := []func() error{
+		func() error {
+			return srv.Run(runCtx, endpoint,
+				server.RunWithGracefulStop(5*time.Second),
+				server.RunWithDrain(time.Second, onDrain))
+		},
+		func() error {
+			defer stopServer()
+			conn, e := grpc.DialContext(ctx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			hc := health_check.NewClient(conn)
+			var resp *health_check.Response
+			if resp, e = hc.Check(ctx, &health_check.Request{}); !assert.NoError(t, e) {
+				return e
+			}
+			assert.Equal(t, health_check.StatusServing, resp.GetStatus())
+
+			stopServer()
+			select {
+			case <-propagation:
+			case <-ctx.Done():
+				assert.Fail(t, "no drain propagation phase")
+				return nil
+			}
+			if resp, e = hc.Check(ctx, &health_check.Request{}); !assert.NoError(t, e) {
+				return e
+			}
+			assert.Equal(t, health_check.StatusNotServing, resp.GetStatus())
+			var r *strlib.UppercaseResponse
+			r, e = strlib.NewStrlibClient(conn).Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			if assert.NoError(t, e) {
+				assert.Equal(t, "ABC", r.GetValue())
+			}
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+	phasesMx.Lock()
+	defer phasesMx.Unlock()
+	assert.Equal(t, []server.DrainPhase{
+		server.DrainNotServing,
+		server.DrainPropagation,
+		server.DrainStopping,
+		server.DrainDone,
+	}, phases)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/server"
+	prometheusMetrics "github.com/thataway/common-lib/server/metrics/prometheus"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"google.golang.org/grpc"
+)
+
+//TestPrometheusHTTPMetrics ...
+func TestPrometheusHTTPMetrics(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7006")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	runCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	pm := prometheusMetrics.NewMetrics(prometheusMetrics.WithNamespace("test"))
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(pm); !assert.NoError(t, err) {
+		return
+	}
+	custom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("custom"))
+	})
+	runners := []func() error{
+		func() error {
+			srv, e := server.NewAPIServer(
+				server.WithServices(service),
+				server.WithHttpHandler("/custom", custom),
+				server.WithStatsHandlers(pm.StatHandlers()...),
+			)
+			if e != nil {
+				cancel()
+				return e
+			}
+			return srv.Run(runCtx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			gConn, e := grpc.DialContext(runCtx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if e != nil {
+				return e
+			}
+			_ = gConn.Close()
+			base := "http://" + endpoint.String()
+			var resp *http.Response
+			for _, path := range []string{"/custom/a/1", "/custom/b/2"} {
+				if resp, e = http.Get(base + path); e != nil { //nolint:noctx
+					return e
+				}
+				_ = resp.Body.Close()
+			}
+			resp, e = http.Post(base+"/v1/uppercase", "application/json", strings.NewReader(`{"value":"abc"}`)) //nolint:noctx
+			if e != nil {
+				return e
+			}
+			_ = resp.Body.Close()
+			if resp, e = http.Get(base + "/v1/unknown/42"); e != nil { //nolint:noctx
+				return e
+			}
+			_ = resp.Body.Close()
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(recorder, r)
+	payload := recorder.Body.String()
+	rePat := []string{
+		`(?m)^test_grpc_server_http_requests\{http_method="GET",route="/custom/\*",status_class="2xx"\} 2$`,
+		`(?m)^test_grpc_server_http_requests\{http_method="POST",route="/v1/uppercase",status_class="2xx"\} 1$`,
+		`(?m)^test_grpc_server_http_requests\{http_method="GET",route="/\*",status_class="4xx"\} 1$`,
+		`(?m)^test_grpc_server_http_response_time_count\{http_method="POST",route="/v1/uppercase"\} 1$`,
+		`(?m)^test_grpc_server_http_request_size_sum\{http_method="POST",route="/v1/uppercase"\} 15$`,
+		`(?m)^test_grpc_server_http_response_size_sum\{http_method="GET",route="/custom/\*"\} 12$`,
+	}
+	for _, pattern := range rePat {
+		assert.Regexpf(t, regexp.MustCompile(pattern), payload, "on-metric-pattern:'%s'", pattern)
+	}
+	assert.NotContains(t, payload, "/custom/a/1")
+}
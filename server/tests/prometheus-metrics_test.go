@@ -20,12 +20,14 @@ import (
 	pkgNet "github.com/thataway/common-lib/pkg/net"
 	"github.com/thataway/common-lib/pkg/parallel"
 	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/health_check"
 	"github.com/thataway/common-lib/server/interceptors"
 	prometheusMetrics "github.com/thataway/common-lib/server/metrics/prometheus"
 	"github.com/thataway/common-lib/server/tests/strlib"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -63,7 +65,8 @@ func TestPrometheusServerMetrics(t *testing.T) {
 		subsystem = "test"
 	)
 	pm := prometheusMetrics.NewMetrics(prometheusMetrics.WithSubsystem(subsystem),
-		prometheusMetrics.WithNamespace(namespace))
+		prometheusMetrics.WithNamespace(namespace),
+		prometheusMetrics.WithPayloadSizeBuckets(8, 1024))
 
 	reg := prometheus.NewRegistry()
 	err = reg.Register(pm)
@@ -112,7 +115,15 @@ func TestPrometheusServerMetrics(t *testing.T) {
 					return e
 				}
 			}
-			return nil
+			//потоковый метод
+			watchCtx, stopWatch := context.WithCancel(runCtx)
+			defer stopWatch()
+			watcher, e1 := health_check.NewClient(gConn).Watch(watchCtx, &health_check.Request{})
+			if e1 != nil {
+				return e1
+			}
+			_, e = watcher.Recv()
+			return e
 		},
 	}
 	//запускаем сервер и клент - ждем остановки
@@ -151,6 +162,14 @@ func TestPrometheusServerMetrics(t *testing.T) {
 		`(?m)test_test_methods_started.+client_name="testUserAgent".+method=".+service=".+\d+`,
 		`(?m)test_test_response_time_bucket.+method=".+service=".+le=".+\d+`,
 		`(?m)test_test_methods_panicked.+client_name="testUserAgent".+method=".+,service=".+\d+`,
+		`(?m)test_test_request_size_bucket\{method="Uppercase",service="strlib.v1.strlib",le="8"\} 0`,
+		`(?m)test_test_request_wire_size_bucket\{method="Uppercase",service="strlib.v1.strlib",le="1024"\} [1-9]\d*`,
+		`(?m)test_test_response_size_bucket\{method="Uppercase",service="strlib.v1.strlib",le="1024"\} [1-9]\d*`,
+		`(?m)test_test_response_wire_size_bucket.+method="Uppercase".+\d+`,
+		`(?m)test_test_stream_messages_bucket.+method="Watch",service="grpc.health.v1.Health",state="sent".+\d+`,
+		`(?m)test_test_stream_message_size_bucket.+method="Watch",service="grpc.health.v1.Health",state="sent".+\d+`,
+		`(?m)^test_test_methods_in_flight\{method="Uppercase",service="strlib.v1.strlib"\} 0$`,
+		`(?m)^test_test_stream_duration_count\{grpc_code=".+",method="Watch",service="grpc.health.v1.Health"\} 1$`,
 	}
 	for i := range rePat {
 		pattern := rePat[i]
@@ -160,5 +179,80 @@ func TestPrometheusServerMetrics(t *testing.T) {
 			return
 		}
 	}
+	//default response time buckets have no 1 ... 7.5 ms steps
+	assert.NotRegexp(t, `(?m)^test_test_response_time_bucket\{method="Uppercase",service="strlib.v1.strlib",le="2.5"\}`,
+		string(payload))
 	t.Log("\r--==all right==------------------------\n")
 }
+
+//TestPrometheusServerMetricsOptions ...
+func TestPrometheusServerMetricsOptions(t *testing.T) {
+	endpoint, err := pkgNet.ParseEndpoint("tcp://127.0.0.1:7005")
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	runCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	pm := prometheusMetrics.NewMetrics(
+		prometheusMetrics.WithNativeUnits(),
+		prometheusMetrics.WithoutClientName(),
+		prometheusMetrics.WithConstLabels(prometheus.Labels{"env": "test"}),
+		prometheusMetrics.WithResponseTimeBuckets(.5, 1),
+		prometheusMetrics.WithExemplars(),
+	)
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(pm); !assert.NoError(t, err) {
+		return
+	}
+	runners := []func() error{
+		func() error {
+			srv, e := server.NewAPIServer(
+				server.WithServices(service),
+				server.WithStatsHandlers(pm.StatHandlers()...),
+			)
+			if e != nil {
+				cancel()
+				return e
+			}
+			return srv.Run(runCtx, endpoint)
+		},
+		func() error {
+			defer cancel()
+			gConn, e := grpc.DialContext(runCtx, endpoint.String(), grpc.WithInsecure(), grpc.WithBlock())
+			if e != nil {
+				return e
+			}
+			defer gConn.Close() //nolint
+			ctx := metadata.AppendToOutgoingContext(runCtx, "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			_, e = strlib.NewStrlibClient(gConn).Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			return e
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(recorder, r)
+	payload := recorder.Body.String()
+	rePat := []string{
+		`(?m)^sbr_grpc_server_methods_started\{env="test",method="Uppercase",service="strlib.v1.strlib"\} 1`,
+		`(?m)^sbr_grpc_server_response_time_seconds_bucket\{env="test",method="Uppercase",service="strlib.v1.strlib",le="0.5"\} 1 # \{trace_id="` + traceID + `"\}`,
+		`(?m)^sbr_grpc_server_request_size_bytes_bucket\{env="test",method="Uppercase",service="strlib.v1.strlib",le="64.0"\} 1`,
+	}
+	for _, pattern := range rePat {
+		assert.Regexpf(t, regexp.MustCompile(pattern), payload, "on-metric-pattern:'%s'", pattern)
+	}
+	assert.NotContains(t, payload, prometheusMetrics.LabelClientName+"=")
+}
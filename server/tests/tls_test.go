@@ -0,0 +1,323 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	pkgNet "github.com/thataway/common-lib/pkg/net"
+	"github.com/thataway/common-lib/pkg/parallel"
+	"github.com/thataway/common-lib/pkg/patterns/observer"
+	"github.com/thataway/common-lib/server"
+	"github.com/thataway/common-lib/server/interceptors"
+	"github.com/thataway/common-lib/server/tests/strlib"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func Test_MutualTLS(t *testing.T) {
+	ca, err := newTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var srvCert, clientCert, gatewayCert tls.Certificate
+	if srvCert, err = ca.issue("server", false); !assert.NoError(t, err) {
+		return
+	}
+	if gatewayCert, err = ca.issue("gateway", true); !assert.NoError(t, err) {
+		return
+	}
+	if clientCert, err = ca.issue("client", true); !assert.NoError(t, err) {
+		return
+	}
+	var endpoint *pkgNet.Endpoint
+	if endpoint, err = pkgNet.ParseEndpoint("tcp://127.0.0.1:7300"); !assert.NoError(t, err) {
+		return
+	}
+	var principal atomic.Value
+	service := new(StrLibImpl)
+	service.ProvideMock().
+		On("Uppercase", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, req *strlib.UppercaseQuery) (*strlib.UppercaseResponse, error) {
+			if p, ok := interceptors.PrincipalFromContext(ctx); ok {
+				principal.Store(p.Name)
+			}
+			return &strlib.UppercaseResponse{Value: strings.ToUpper(req.GetValue())}, nil
+		})
+	var auth *interceptors.Authenticator
+	auth, err = interceptors.NewAuthenticator(interceptors.AuthWithVerifiers(
+		interceptors.NewMTLSVerifier(interceptors.MTLSTrustForwardedFrom("gateway")),
+	))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var srv *server.APIServer
+	srv, err = server.NewAPIServer(
+		server.WithServices(service),
+		server.WithUnaryInterceptors(auth.Unary),
+		server.WithStreamInterceptors(auth.Stream),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	clientTLS := &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	err = srv.Run(ctx, endpoint, server.RunWithTLS(
+		server.TLSWithCertificates(srvCert),
+		server.TLSWithClientCAs(ca.pool),
+	))
+	assert.Error(t, err) //gateway client certificate is required
+	runners := []func() error{
+		func() error {
+			return srv.Run(ctx, endpoint, server.RunWithTLS(
+				server.TLSWithCertificates(srvCert),
+				server.TLSWithClientCAs(ca.pool),
+				server.TLSWithGatewayClientCert(gatewayCert),
+			))
+		},
+		func() error {
+			defer cancel()
+			conn, e := grpc.DialContext(ctx, endpoint.String(),
+				grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)),
+				grpc.WithBlock())
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer conn.Close() //nolint
+			var resp *strlib.UppercaseResponse
+			resp, e = strlib.NewStrlibClient(conn).Uppercase(ctx, &strlib.UppercaseQuery{Value: "abc"})
+			if !assert.NoError(t, e) {
+				return e
+			}
+			assert.Equal(t, "ABC", resp.GetValue())
+			assert.Equal(t, "client", principal.Load())
+			principal.Store("")
+
+			httpClient := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: clientTLS},
+			}
+			data, _ := json.Marshal(&strlib.UppercaseQuery{Value: "qwe"})
+			var httpResp *http.Response
+			httpResp, e = httpClient.Post("https://"+endpoint.String()+"/v1/uppercase",
+				"application/json", bytes.NewBuffer(data))
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer httpResp.Body.Close() //nolint
+			resp = nil
+			_ = json.NewDecoder(httpResp.Body).Decode(&resp)
+			assert.Equal(t, "QWE", resp.GetValue())
+			assert.Equal(t, "client", principal.Load())
+			principal.Store("")
+
+			//HTTP/2 client negotiates 'h2' and still gets gateway
+			h2Client := &http.Client{
+				Transport: &http2.Transport{TLSClientConfig: clientTLS},
+			}
+			data, _ = json.Marshal(&strlib.UppercaseQuery{Value: "xyz"})
+			var h2Resp *http.Response
+			h2Resp, e = h2Client.Post("https://"+endpoint.String()+"/v1/uppercase",
+				"application/json", bytes.NewBuffer(data))
+			if !assert.NoError(t, e) {
+				return e
+			}
+			defer h2Resp.Body.Close() //nolint
+			assert.Equal(t, 2, h2Resp.ProtoMajor)
+			assert.Equal(t, http.StatusOK, h2Resp.StatusCode)
+			resp = nil
+			_ = json.NewDecoder(h2Resp.Body).Decode(&resp)
+			assert.Equal(t, "XYZ", resp.GetValue())
+			assert.Equal(t, "client", principal.Load())
+
+			noCertClient := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{
+					RootCAs:    ca.pool,
+					MinVersion: tls.VersionTLS12,
+				}},
+			}
+			_, e = noCertClient.Post("https://"+endpoint.String()+"/v1/uppercase",
+				"application/json", bytes.NewBuffer(data))
+			assert.Error(t, e)
+			return nil
+		},
+	}
+	err = parallel.ExecAbstract(len(runners), int32(len(runners))-1, func(i int) error {
+		return runners[i]()
+	})
+	assert.NoError(t, err)
+}
+
+func Test_FileCertProvider(t *testing.T) {
+	ca, err := newTestCA()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var dir string
+	if dir, err = ioutil.TempDir("", "certs"); !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) //nolint
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err = ca.issueFiles("server-1", certFile, keyFile); !assert.NoError(t, err) {
+		return
+	}
+	var provider *server.FileCertProvider
+	provider, err = server.NewFileCertProvider(certFile, keyFile,
+		server.FileCertWithCheckInterval(50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	chReloaded := make(chan server.OnCertReloaded, 10)
+	chFailed := make(chan server.OnCertReloadFailed, 10)
+	obs := observer.NewObserver(func(event observer.EventType) {
+		switch ev := event.(type) {
+		case server.OnCertReloaded:
+			chReloaded <- ev
+		case server.OnCertReloadFailed:
+			chFailed <- ev
+		}
+	}, false, server.OnCertReloaded{}, server.OnCertReloadFailed{})
+	provider.Subject().ObserversAttach(obs)
+	defer provider.Subject().ObserversDetach(obs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = provider.Watch(ctx)
+	}()
+	var cert *tls.Certificate
+	if cert, err = provider.GetCertificate(nil); !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "server-1", cert.Leaf.Subject.CommonName)
+
+	time.Sleep(20 * time.Millisecond)
+	if err = ca.issueFiles("server-2", certFile, keyFile); !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case <-chReloaded:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "certificate is not reloaded")
+		return
+	}
+	cert, _ = provider.GetCertificate(nil)
+	assert.Equal(t, "server-2", cert.Leaf.Subject.CommonName)
+
+	if err = ioutil.WriteFile(keyFile, []byte("garbage"), 0600); !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case ev := <-chFailed:
+		assert.Error(t, ev.Reason)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "reload failure is not published")
+		return
+	}
+	cert, _ = provider.GetCertificate(nil)
+	assert.Equal(t, "server-2", cert.Leaf.Subject.CommonName)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA() (*testCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key); err != nil {
+		return nil, err
+	}
+	ret := &testCA{key: key, pool: x509.NewCertPool()}
+	if ret.cert, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	ret.pool.AddCert(ret.cert)
+	return ret, nil
+}
+
+func (ca *testCA) issueDER(cn string, isClient bool) (certDER []byte, key *ecdsa.PrivateKey, err error) {
+	if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return nil, nil, err
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	if isClient {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	certDER, err = x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	return certDER, key, err
+}
+
+func (ca *testCA) issue(cn string, isClient bool) (tls.Certificate, error) {
+	der, key, err := ca.issueDER(cn, isClient)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func (ca *testCA) issueFiles(cn string, certFile, keyFile string) error {
+	der, key, err := ca.issueDER(cn, false)
+	if err != nil {
+		return err
+	}
+	var keyDER []byte
+	if keyDER, err = x509.MarshalECPrivateKey(key); err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}